@@ -0,0 +1,42 @@
+package audio
+
+import "io"
+
+// readFrames is how many frames are decoded at a time
+const readFrames = 4096
+
+// Sink consumes decoded audio. Each call gets one slice per channel, all of
+// the same length.
+type Sink interface {
+	Write(block [][]float64)
+}
+
+// Analyze decodes the whole stream once, feeding every sink. It returns the
+// number of frames decoded.
+func Analyze(d Decoder, sinks ...Sink) (int64, error) {
+	buf := make([][]float64, d.Format().Channels)
+	for ch := range buf {
+		buf[ch] = make([]float64, readFrames)
+	}
+	block := make([][]float64, len(buf))
+
+	var frames int64
+	for {
+		n, err := d.Read(buf)
+		if n > 0 {
+			for ch := range buf {
+				block[ch] = buf[ch][:n]
+			}
+			for _, sink := range sinks {
+				sink.Write(block)
+			}
+			frames += int64(n)
+		}
+		if err == io.EOF {
+			return frames, nil
+		}
+		if err != nil {
+			return frames, err
+		}
+	}
+}
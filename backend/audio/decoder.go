@@ -0,0 +1,77 @@
+// Package audio decodes uncompressed and losslessly compressed audio in pure Go
+// and computes the waveform data the frontend draws.
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+var (
+	// ErrUnsupportedFormat is returned for audio the package cannot decode
+	ErrUnsupportedFormat = errors.New("audio: unsupported format")
+	// ErrInvalidData is returned when a stream does not follow its format
+	ErrInvalidData = errors.New("audio: invalid data")
+)
+
+// Format describes a decoded stream
+type Format struct {
+	SampleRate int
+	Channels   int
+	BitDepth   int
+	Frames     int64 // Total frames, 0 when the stream does not say
+}
+
+// Duration returns the length of the stream in seconds
+func (f Format) Duration() float64 {
+	if f.SampleRate == 0 {
+		return 0
+	}
+	return float64(f.Frames) / float64(f.SampleRate)
+}
+
+// Decoder reads audio as floating point samples in [-1, 1]
+type Decoder interface {
+	Format() Format
+	// Read fills buf, one slice per channel, with up to len(buf[0]) frames.
+	// It returns the number of frames read and io.EOF at the end of the stream.
+	Read(buf [][]float64) (int, error)
+}
+
+// NewDecoder picks a decoder from the first bytes of r
+func NewDecoder(r io.Reader) (Decoder, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	if err := skipID3(br); err != nil {
+		return nil, err
+	}
+
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	switch {
+	case bytes.Equal(magic, []byte("RIFF")), bytes.Equal(magic, []byte("RF64")):
+		return newWAVDecoder(br)
+	case bytes.Equal(magic, []byte("fLaC")):
+		return newFLACDecoder(br)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// skipID3 discards an ID3v2 tag, which some encoders put in front of any stream
+func skipID3(br *bufio.Reader) error {
+	header, err := br.Peek(10)
+	if err != nil || !bytes.Equal(header[:3], []byte("ID3")) {
+		return nil
+	}
+	size := int(header[6]&0x7f)<<21 | int(header[7]&0x7f)<<14 | int(header[8]&0x7f)<<7 | int(header[9]&0x7f)
+	if header[5]&0x10 != 0 {
+		size += 10 // Footer
+	}
+	if _, err := br.Discard(10 + size); err != nil {
+		return ErrInvalidData
+	}
+	return nil
+}
@@ -0,0 +1,525 @@
+package audio
+
+import (
+	"bufio"
+	"io"
+)
+
+// FLAC metadata block types
+const flacStreamInfo = 0
+
+// FLAC channel assignments beyond plain independent channels
+const (
+	flacLeftSide  = 8
+	flacSideRight = 9
+	flacMidSide   = 10
+)
+
+type flacDecoder struct {
+	br     *bitReader
+	format Format
+
+	block [][]int64 // Samples of the current frame
+	size  int       // Frames in the current block
+	pos   int       // Next frame of the block to hand out
+	scale float64
+}
+
+func newFLACDecoder(r *bufio.Reader) (*flacDecoder, error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, ErrInvalidData
+	}
+
+	d := &flacDecoder{br: &bitReader{r: r}}
+	haveInfo := false
+	for last := false; !last; {
+		var header [4]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, ErrInvalidData
+		}
+		last = header[0]&0x80 != 0
+		kind := header[0] & 0x7f
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+
+		// Only the stream info is needed; pictures and tags are skipped unread
+		if kind != flacStreamInfo {
+			if _, err := io.CopyN(io.Discard, r, int64(length)); err != nil {
+				return nil, ErrInvalidData
+			}
+			continue
+		}
+		if length < 18 || length > 1<<10 {
+			return nil, ErrInvalidData
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, ErrInvalidData
+		}
+		// 20 bits sample rate, 3 bits channels - 1, 5 bits depth - 1, 36 bits total samples
+		packed := uint64(0)
+		for _, b := range body[10:18] {
+			packed = packed<<8 | uint64(b)
+		}
+		d.format = Format{
+			SampleRate: int(packed >> 44),
+			Channels:   int(packed>>41&0x7) + 1,
+			BitDepth:   int(packed>>36&0x1f) + 1,
+			Frames:     int64(packed & 0xfffffffff),
+		}
+		haveInfo = true
+	}
+	if !haveInfo || d.format.SampleRate == 0 {
+		return nil, ErrInvalidData
+	}
+	return d, nil
+}
+
+func (d *flacDecoder) Format() Format {
+	return d.format
+}
+
+func (d *flacDecoder) Read(buf [][]float64) (int, error) {
+	n := 0
+	for n < len(buf[0]) {
+		if d.pos == d.size {
+			if err := d.readFrame(); err != nil {
+				if err == io.EOF && n > 0 {
+					return n, nil
+				}
+				return n, err
+			}
+		}
+		count := d.size - d.pos
+		if count > len(buf[0])-n {
+			count = len(buf[0]) - n
+		}
+		for ch := range d.block {
+			src := d.block[ch][d.pos : d.pos+count]
+			dst := buf[ch][n : n+count]
+			for i, v := range src {
+				dst[i] = float64(v) * d.scale
+			}
+		}
+		d.pos += count
+		n += count
+	}
+	return n, nil
+}
+
+// readFrame decodes the next frame into d.block
+func (d *flacDecoder) readFrame() error {
+	br := d.br
+	br.align()
+
+	sync, err := br.read(14)
+	if err != nil {
+		return io.EOF
+	}
+	if sync != 0x3ffe {
+		return ErrInvalidData
+	}
+	if _, err := br.read(2); err != nil { // Reserved, blocking strategy
+		return ErrInvalidData
+	}
+	header, err := br.read(16)
+	if err != nil {
+		return ErrInvalidData
+	}
+	sizeCode := int(header >> 12)
+	rateCode := int(header >> 8 & 0xf)
+	assignment := int(header >> 4 & 0xf)
+	depthCode := int(header >> 1 & 0x7)
+
+	if err := br.skipUTF8(); err != nil {
+		return err
+	}
+
+	var blockSize int
+	switch {
+	case sizeCode == 1:
+		blockSize = 192
+	case sizeCode >= 2 && sizeCode <= 5:
+		blockSize = 576 << (sizeCode - 2)
+	case sizeCode == 6:
+		v, err := br.read(8)
+		if err != nil {
+			return ErrInvalidData
+		}
+		blockSize = int(v) + 1
+	case sizeCode == 7:
+		v, err := br.read(16)
+		if err != nil {
+			return ErrInvalidData
+		}
+		blockSize = int(v) + 1
+	case sizeCode >= 8:
+		blockSize = 256 << (sizeCode - 8)
+	default:
+		return ErrInvalidData
+	}
+
+	// The frame's own sample rate is not needed; skip the bits that carry it
+	switch rateCode {
+	case 12:
+		_, err = br.read(8)
+	case 13, 14:
+		_, err = br.read(16)
+	case 15:
+		return ErrInvalidData
+	}
+	if err != nil {
+		return ErrInvalidData
+	}
+
+	depth := d.format.BitDepth
+	switch depthCode {
+	case 1:
+		depth = 8
+	case 2:
+		depth = 12
+	case 4:
+		depth = 16
+	case 5:
+		depth = 20
+	case 6:
+		depth = 24
+	case 7:
+		depth = 32
+	case 3:
+		return ErrInvalidData
+	}
+
+	if _, err := br.read(8); err != nil { // CRC-8
+		return ErrInvalidData
+	}
+
+	channels := assignment + 1
+	if assignment >= flacLeftSide {
+		if assignment > flacMidSide {
+			return ErrInvalidData
+		}
+		channels = 2
+	}
+	if channels != d.format.Channels {
+		return ErrInvalidData
+	}
+
+	if len(d.block) != channels {
+		d.block = make([][]int64, channels)
+	}
+	for ch := 0; ch < channels; ch++ {
+		if cap(d.block[ch]) < blockSize {
+			d.block[ch] = make([]int64, blockSize)
+		}
+		d.block[ch] = d.block[ch][:blockSize]
+
+		// The side channel carries one extra bit
+		chDepth := depth
+		if (assignment == flacLeftSide || assignment == flacMidSide) && ch == 1 ||
+			assignment == flacSideRight && ch == 0 {
+			chDepth++
+		}
+		if err := d.readSubframe(d.block[ch], chDepth); err != nil {
+			return err
+		}
+	}
+
+	left, right := d.block[0], d.block[len(d.block)-1]
+	switch assignment {
+	case flacLeftSide:
+		for i := range left {
+			right[i] = left[i] - right[i]
+		}
+	case flacSideRight:
+		for i := range left {
+			left[i] += right[i]
+		}
+	case flacMidSide:
+		for i := range left {
+			mid := left[i]<<1 | right[i]&1
+			side := right[i]
+			left[i] = (mid + side) >> 1
+			right[i] = (mid - side) >> 1
+		}
+	}
+
+	br.align()
+	if _, err := br.read(16); err != nil { // CRC-16
+		return ErrInvalidData
+	}
+
+	d.size = blockSize
+	d.pos = 0
+	d.scale = 1 / float64(int64(1)<<(depth-1))
+	return nil
+}
+
+// readSubframe decodes one channel of a frame into out
+func (d *flacDecoder) readSubframe(out []int64, depth int) error {
+	br := d.br
+	header, err := br.read(8)
+	if err != nil {
+		return ErrInvalidData
+	}
+	kind := int(header >> 1 & 0x3f)
+
+	wasted := 0
+	if header&1 != 0 {
+		zeros, err := br.unary()
+		if err != nil {
+			return ErrInvalidData
+		}
+		wasted = zeros + 1
+		depth -= wasted
+	}
+	if depth <= 0 {
+		return ErrInvalidData
+	}
+
+	switch {
+	case kind == 0: // Constant
+		v, err := br.signed(depth)
+		if err != nil {
+			return ErrInvalidData
+		}
+		for i := range out {
+			out[i] = v
+		}
+	case kind == 1: // Verbatim
+		for i := range out {
+			if out[i], err = br.signed(depth); err != nil {
+				return ErrInvalidData
+			}
+		}
+	case kind >= 8 && kind <= 12: // Fixed predictor
+		if err := d.readFixed(out, kind-8, depth); err != nil {
+			return err
+		}
+	case kind >= 32: // Linear prediction
+		if err := d.readLPC(out, kind-31, depth); err != nil {
+			return err
+		}
+	default:
+		return ErrInvalidData
+	}
+
+	if wasted > 0 {
+		for i := range out {
+			out[i] <<= wasted
+		}
+	}
+	return nil
+}
+
+func (d *flacDecoder) readFixed(out []int64, order, depth int) error {
+	if order > len(out) {
+		return ErrInvalidData
+	}
+	for i := 0; i < order; i++ {
+		v, err := d.br.signed(depth)
+		if err != nil {
+			return ErrInvalidData
+		}
+		out[i] = v
+	}
+	if err := d.readResidual(out, order); err != nil {
+		return err
+	}
+
+	for i := order; i < len(out); i++ {
+		switch order {
+		case 1:
+			out[i] += out[i-1]
+		case 2:
+			out[i] += 2*out[i-1] - out[i-2]
+		case 3:
+			out[i] += 3*out[i-1] - 3*out[i-2] + out[i-3]
+		case 4:
+			out[i] += 4*out[i-1] - 6*out[i-2] + 4*out[i-3] - out[i-4]
+		}
+	}
+	return nil
+}
+
+func (d *flacDecoder) readLPC(out []int64, order, depth int) error {
+	br := d.br
+	if order > len(out) {
+		return ErrInvalidData
+	}
+	for i := 0; i < order; i++ {
+		v, err := br.signed(depth)
+		if err != nil {
+			return ErrInvalidData
+		}
+		out[i] = v
+	}
+
+	precision, err := br.read(4)
+	if err != nil || precision == 0xf {
+		return ErrInvalidData
+	}
+	shift, err := br.signed(5)
+	if err != nil || shift < 0 {
+		return ErrInvalidData
+	}
+	coefs := make([]int64, order)
+	for i := range coefs {
+		if coefs[i], err = br.signed(int(precision) + 1); err != nil {
+			return ErrInvalidData
+		}
+	}
+	if err := d.readResidual(out, order); err != nil {
+		return err
+	}
+
+	for i := order; i < len(out); i++ {
+		var sum int64
+		for j, c := range coefs {
+			sum += c * out[i-1-j]
+		}
+		out[i] += sum >> uint(shift)
+	}
+	return nil
+}
+
+// readResidual reads the Rice coded prediction errors into out[order:]
+func (d *flacDecoder) readResidual(out []int64, order int) error {
+	br := d.br
+	method, err := br.read(2)
+	if err != nil || method > 1 {
+		return ErrInvalidData
+	}
+	paramBits, escape := 4, uint64(0xf)
+	if method == 1 {
+		paramBits, escape = 5, 0x1f
+	}
+
+	partitionOrder, err := br.read(4)
+	if err != nil {
+		return ErrInvalidData
+	}
+	partitions := 1 << partitionOrder
+	perPartition := len(out) >> partitionOrder
+	if perPartition<<partitionOrder != len(out) || perPartition < order {
+		return ErrInvalidData
+	}
+
+	i := order
+	for p := 0; p < partitions; p++ {
+		count := perPartition
+		if p == 0 {
+			count -= order
+		}
+		param, err := br.read(paramBits)
+		if err != nil {
+			return ErrInvalidData
+		}
+
+		if param == escape {
+			bits, err := br.read(5)
+			if err != nil {
+				return ErrInvalidData
+			}
+			for ; count > 0; count-- {
+				if bits == 0 {
+					out[i] = 0
+				} else if out[i], err = br.signed(int(bits)); err != nil {
+					return ErrInvalidData
+				}
+				i++
+			}
+			continue
+		}
+
+		for ; count > 0; count-- {
+			q, err := br.unary()
+			if err != nil {
+				return ErrInvalidData
+			}
+			low, err := br.read(int(param))
+			if err != nil {
+				return ErrInvalidData
+			}
+			u := uint64(q)<<param | low
+			out[i] = int64(u>>1) ^ -int64(u&1)
+			i++
+		}
+	}
+	return nil
+}
+
+// bitReader reads big-endian bit fields
+type bitReader struct {
+	r     *bufio.Reader
+	cache uint64
+	n     uint // Valid low bits in cache
+}
+
+// read returns the next n bits, n <= 56
+func (b *bitReader) read(n int) (uint64, error) {
+	for b.n < uint(n) {
+		c, err := b.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		b.cache = b.cache<<8 | uint64(c)
+		b.n += 8
+	}
+	b.n -= uint(n)
+	v := b.cache >> b.n & (1<<uint(n) - 1)
+	b.cache &= 1<<b.n - 1
+	return v, nil
+}
+
+// signed reads an n bit two's complement value
+func (b *bitReader) signed(n int) (int64, error) {
+	v, err := b.read(n)
+	if err != nil {
+		return 0, err
+	}
+	return int64(v<<(64-uint(n))) >> (64 - uint(n)), nil
+}
+
+// unary counts zero bits up to the next one bit
+func (b *bitReader) unary() (int, error) {
+	count := 0
+	for {
+		bit, err := b.read(1)
+		if err != nil {
+			return 0, err
+		}
+		if bit == 1 {
+			return count, nil
+		}
+		count++
+	}
+}
+
+// align drops the bits left in a partly read byte
+func (b *bitReader) align() {
+	b.n -= b.n % 8
+	b.cache &= 1<<b.n - 1
+}
+
+// skipUTF8 skips the frame or sample number, coded like UTF-8
+func (b *bitReader) skipUTF8() error {
+	first, err := b.read(8)
+	if err != nil {
+		return ErrInvalidData
+	}
+	extra := 0
+	for mask := uint64(0x80); first&mask != 0 && mask > 1; mask >>= 1 {
+		extra++
+	}
+	if extra == 1 || extra > 7 {
+		return ErrInvalidData
+	}
+	if extra > 0 {
+		extra--
+	}
+	if _, err := b.read(8 * extra); err != nil {
+		return ErrInvalidData
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package audio
+
+import (
+	"math"
+	"sort"
+)
+
+// MinLevel is reported for silence, where a level in dB is not defined
+const MinLevel = -120.0
+
+// Gating constants from ITU-R BS.1770-4 and EBU Tech 3342
+const (
+	absoluteGate   = -70.0 // LUFS
+	relativeGate   = -10.0 // LU below the absolute-gated loudness
+	rangeGate      = -20.0 // LU below the absolute-gated short-term loudness
+	momentarySteps = 4     // 400 ms blocks made of 100 ms steps
+	shortTermSteps = 30    // 3 s windows made of 100 ms steps
+	truePeakTaps   = 12    // Interpolation filter taps per phase
+)
+
+// Loudness is the level analysis of a stream
+type Loudness struct {
+	Integrated   float64 // LUFS
+	ShortTermMax float64 // LUFS, loudest 3 s window
+	Range        float64 // LU, EBU loudness range
+	SamplePeak   float64 // dBFS
+	TruePeak     float64 // dBTP, from 4x oversampling at 44.1 and 48 kHz
+	RMS          float64 // dBFS over all channels, a full scale sine reads -3
+}
+
+// LoudnessMeter is a Sink measuring loudness as BS.1770 describes it
+type LoudnessMeter struct {
+	weights []float64
+	filters []kFilter
+	peaks   []*truePeakMeter
+
+	step       int       // Frames in 100 ms
+	inStep     int       // Frames in the current step
+	stepEnergy float64   // Weighted sum of squares of the current step
+	steps      []float64 // Weighted sums of squares of completed steps
+
+	samplePeak float64
+	sumSquares float64
+	samples    int64
+}
+
+// NewLoudnessMeter returns a LoudnessMeter for a stream of the given format
+func NewLoudnessMeter(format Format) *LoudnessMeter {
+	m := &LoudnessMeter{
+		weights: channelWeights(format.Channels),
+		filters: make([]kFilter, format.Channels),
+		peaks:   make([]*truePeakMeter, format.Channels),
+		step:    format.SampleRate / 10,
+	}
+	for ch := range m.filters {
+		m.filters[ch] = newKFilter(float64(format.SampleRate))
+		m.peaks[ch] = newTruePeakMeter(format.SampleRate)
+	}
+	return m
+}
+
+// channelWeights weights surround channels up and leaves out the LFE, assuming
+// the usual L, R, C, LFE, Ls, Rs order
+func channelWeights(channels int) []float64 {
+	weights := make([]float64, channels)
+	for ch := range weights {
+		weights[ch] = 1
+	}
+	switch channels {
+	case 5:
+		weights[3], weights[4] = 1.41, 1.41
+	case 6:
+		weights[3], weights[4], weights[5] = 0, 1.41, 1.41
+	}
+	return weights
+}
+
+func (m *LoudnessMeter) Write(block [][]float64) {
+	for i := range block[0] {
+		for ch := range block {
+			v := block[ch][i]
+			if a := math.Abs(v); a > m.samplePeak {
+				m.samplePeak = a
+			}
+			m.sumSquares += v * v
+			m.peaks[ch].write(v)
+
+			k := m.filters[ch].process(v)
+			m.stepEnergy += m.weights[ch] * k * k
+		}
+		m.samples += int64(len(block))
+
+		m.inStep++
+		if m.inStep == m.step {
+			m.steps = append(m.steps, m.stepEnergy)
+			m.stepEnergy = 0
+			m.inStep = 0
+		}
+	}
+}
+
+// Loudness returns the levels of everything written so far. Blocks still
+// incomplete at the end are left out, as the standard asks.
+func (m *LoudnessMeter) Loudness() Loudness {
+	result := Loudness{
+		Integrated:   MinLevel,
+		ShortTermMax: MinLevel,
+		SamplePeak:   decibels(m.samplePeak),
+		RMS:          MinLevel,
+	}
+	if m.samples > 0 {
+		result.RMS = decibels(math.Sqrt(m.sumSquares / float64(m.samples)))
+	}
+
+	truePeak := m.samplePeak
+	for _, p := range m.peaks {
+		truePeak = math.Max(truePeak, p.peak)
+	}
+	result.TruePeak = decibels(truePeak)
+
+	momentary := m.windows(momentarySteps)
+	if integrated, ok := gatedMean(momentary, relativeGate); ok {
+		result.Integrated = lufs(integrated)
+	}
+
+	shortTerm := m.windows(shortTermSteps)
+	for _, z := range shortTerm {
+		result.ShortTermMax = math.Max(result.ShortTermMax, lufs(z))
+	}
+	result.Range = loudnessRange(shortTerm)
+	return result
+}
+
+// windows returns the mean square of every window of size steps, sliding by one step
+func (m *LoudnessMeter) windows(size int) []float64 {
+	if len(m.steps) < size || m.step == 0 {
+		return nil
+	}
+	out := make([]float64, 0, len(m.steps)-size+1)
+	sum := 0.0
+	for i, e := range m.steps {
+		sum += e
+		if i >= size {
+			sum -= m.steps[i-size]
+		}
+		if i >= size-1 {
+			out = append(out, math.Max(sum, 0)/float64(size*m.step))
+		}
+	}
+	return out
+}
+
+// gatedMean applies the absolute gate and then a gate relative to the mean of
+// what passed it. It returns the mean square of the surviving blocks.
+func gatedMean(blocks []float64, relative float64) (float64, bool) {
+	mean, ok := meanAbove(blocks, energy(absoluteGate))
+	if !ok {
+		return 0, false
+	}
+	threshold := math.Max(energy(absoluteGate), energy(lufs(mean)+relative))
+	return meanAbove(blocks, threshold)
+}
+
+func meanAbove(blocks []float64, threshold float64) (float64, bool) {
+	sum, count := 0.0, 0
+	for _, z := range blocks {
+		if z > threshold {
+			sum += z
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return sum / float64(count), true
+}
+
+// loudnessRange is the spread between the 10th and 95th percentile of the
+// gated short-term loudness, per EBU Tech 3342
+func loudnessRange(shortTerm []float64) float64 {
+	mean, ok := meanAbove(shortTerm, energy(absoluteGate))
+	if !ok {
+		return 0
+	}
+	threshold := math.Max(energy(absoluteGate), energy(lufs(mean)+rangeGate))
+
+	levels := []float64{}
+	for _, z := range shortTerm {
+		if z > threshold {
+			levels = append(levels, lufs(z))
+		}
+	}
+	if len(levels) == 0 {
+		return 0
+	}
+	sort.Float64s(levels)
+	return percentile(levels, 0.95) - percentile(levels, 0.10)
+}
+
+// percentile interpolates linearly between the closest ranks of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	pos := p * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(pos-float64(lower))
+}
+
+// lufs converts a weighted mean square to loudness
+func lufs(z float64) float64 {
+	if z <= 0 {
+		return MinLevel
+	}
+	return math.Max(MinLevel, -0.691+10*math.Log10(z))
+}
+
+// energy is the inverse of lufs
+func energy(l float64) float64 {
+	return math.Pow(10, (l+0.691)/10)
+}
+
+// decibels converts a linear amplitude to dB
+func decibels(v float64) float64 {
+	if v <= 0 {
+		return MinLevel
+	}
+	return math.Max(MinLevel, 20*math.Log10(v))
+}
+
+// biquad is a second order IIR filter in direct form I
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// kFilter is the K-weighting of BS.1770: a high shelf modelling the head
+// followed by a high pass
+type kFilter struct {
+	shelf, highPass biquad
+}
+
+// newKFilter derives the K-weighting coefficients for any sample rate, so
+// they match the published 48 kHz values there
+func newKFilter(rate float64) kFilter {
+	const (
+		shelfFreq = 1681.974450955533
+		shelfGain = 3.999843853973347
+		shelfQ    = 0.7071752369554196
+		passFreq  = 38.13547087602444
+		passQ     = 0.5003270373238773
+	)
+
+	k := math.Tan(math.Pi * shelfFreq / rate)
+	vh := math.Pow(10, shelfGain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/shelfQ + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/shelfQ + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/shelfQ + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/shelfQ + k*k) / a0,
+	}
+
+	k = math.Tan(math.Pi * passFreq / rate)
+	a0 = 1 + k/passQ + k*k
+	highPass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/passQ + k*k) / a0,
+	}
+	return kFilter{shelf: shelf, highPass: highPass}
+}
+
+func (f *kFilter) process(x float64) float64 {
+	return f.highPass.process(f.shelf.process(x))
+}
+
+// truePeakMeter estimates the peak between samples by oversampling with a
+// windowed sinc interpolator
+type truePeakMeter struct {
+	factor  int
+	phases  [][]float64 // Filter taps of each output phase
+	history []float64   // Latest input samples, newest first
+	peak    float64
+}
+
+func newTruePeakMeter(sampleRate int) *truePeakMeter {
+	factor := 4
+	switch {
+	case sampleRate >= 176400:
+		factor = 1
+	case sampleRate >= 88200:
+		factor = 2
+	}
+
+	m := &truePeakMeter{factor: factor, history: make([]float64, truePeakTaps)}
+	if factor == 1 {
+		return m
+	}
+
+	n := factor * truePeakTaps
+	center := float64(n-1) / 2
+	m.phases = make([][]float64, factor)
+	for p := range m.phases {
+		m.phases[p] = make([]float64, truePeakTaps)
+		for k := range m.phases[p] {
+			j := p + k*factor
+			t := (float64(j) - center) / float64(factor)
+			window := 0.5 - 0.5*math.Cos(2*math.Pi*(float64(j)+0.5)/float64(n))
+			m.phases[p][k] = sinc(t) * window
+		}
+	}
+	return m
+}
+
+func (m *truePeakMeter) write(x float64) {
+	if m.factor == 1 {
+		m.peak = math.Max(m.peak, math.Abs(x))
+		return
+	}
+	copy(m.history[1:], m.history[:len(m.history)-1])
+	m.history[0] = x
+	for _, taps := range m.phases {
+		y := 0.0
+		for k, h := range taps {
+			y += h * m.history[k]
+		}
+		m.peak = math.Max(m.peak, math.Abs(y))
+	}
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
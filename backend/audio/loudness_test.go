@@ -0,0 +1,126 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// segment is a stretch of 1 kHz sine at a peak level in dBFS
+type segment struct {
+	level   float64
+	seconds float64
+}
+
+// measure feeds the segments, on every channel, through a LoudnessMeter
+func measure(rate, channels int, segments ...segment) Loudness {
+	m := NewLoudnessMeter(Format{SampleRate: rate, Channels: channels, BitDepth: 24})
+	const blockSize = 4096
+	phase := 0.0
+	for _, s := range segments {
+		amplitude := 0.0
+		if s.level > MinLevel {
+			amplitude = math.Pow(10, s.level/20)
+		}
+		frames := int(s.seconds * float64(rate))
+		for frames > 0 {
+			n := min(frames, blockSize)
+			block := make([][]float64, channels)
+			for ch := range block {
+				block[ch] = make([]float64, n)
+			}
+			for i := 0; i < n; i++ {
+				v := amplitude * math.Sin(phase)
+				for ch := range block {
+					block[ch][i] = v
+				}
+				phase += 2 * math.Pi * 1000 / float64(rate)
+			}
+			m.Write(block)
+			frames -= n
+		}
+	}
+	return m.Loudness()
+}
+
+func near(t *testing.T, name string, got, want, tolerance float64) {
+	t.Helper()
+	if math.Abs(got-want) > tolerance {
+		t.Errorf("%s = %.2f, want %.2f ± %.2f", name, got, want, tolerance)
+	}
+}
+
+func TestLoudnessOfSine(t *testing.T) {
+	// BS.1770 reads a 1 kHz sine at 0 dBFS on one channel as -3.01 LUFS, and
+	// EBU Tech 3341 the same sine at -23 dBFS on both stereo channels as -23
+	tests := []struct {
+		name     string
+		rate     int
+		channels int
+		level    float64
+		want     float64
+	}{
+		{"mono full scale 48 kHz", 48000, 1, 0, -3.01},
+		{"stereo -23 dBFS 48 kHz", 48000, 2, -23, -23},
+		{"stereo -23 dBFS 44.1 kHz", 44100, 2, -23, -23},
+		{"stereo -20 dBFS 96 kHz", 96000, 2, -20, -20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := measure(tt.rate, tt.channels, segment{tt.level, 20})
+			near(t, "Integrated", got.Integrated, tt.want, 0.1)
+			near(t, "ShortTermMax", got.ShortTermMax, tt.want, 0.1)
+			near(t, "Range", got.Range, 0, 0.1)
+			near(t, "SamplePeak", got.SamplePeak, tt.level, 0.01)
+			near(t, "TruePeak", got.TruePeak, tt.level, 0.1)
+			near(t, "RMS", got.RMS, tt.level-3.01, 0.01)
+		})
+	}
+}
+
+func TestLoudnessGating(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments []segment
+		want     float64
+	}{
+		// EBU Tech 3341 case 3: the quiet parts fall below the relative gate
+		{"relative gate", []segment{{-36, 10}, {-23, 60}, {-36, 10}}, -23},
+		// EBU Tech 3341 case 4: the absolute gate drops the near silence
+		// before the relative gate is placed
+		{"absolute gate", []segment{{-72, 10}, {-36, 10}, {-23, 60}, {-36, 10}, {-72, 10}}, -23},
+		{"silence between", []segment{{-23, 10}, {MinLevel, 20}, {-23, 10}}, -23},
+		// Both parts are within 10 LU, so both count towards the mean
+		{"within the relative gate", []segment{{-20, 20}, {-26, 20}}, -22.03},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := measure(48000, 2, tt.segments...)
+			near(t, "Integrated", got.Integrated, tt.want, 0.1)
+		})
+	}
+}
+
+func TestLoudnessOfSilence(t *testing.T) {
+	got := measure(48000, 2, segment{MinLevel, 5})
+	if got.Integrated != MinLevel || got.ShortTermMax != MinLevel || got.SamplePeak != MinLevel || got.RMS != MinLevel {
+		t.Errorf("silence measured as %+v", got)
+	}
+	if got.Range != 0 {
+		t.Errorf("Range of silence = %.2f, want 0", got.Range)
+	}
+}
+
+func TestLoudnessLeavesOutShortStreams(t *testing.T) {
+	// Less than one 400 ms block gives no gated loudness at all
+	got := measure(48000, 2, segment{-23, 0.3})
+	if got.Integrated != MinLevel {
+		t.Errorf("Integrated of 300 ms = %.2f, want %.2f", got.Integrated, MinLevel)
+	}
+	near(t, "SamplePeak", got.SamplePeak, -23, 0.01)
+}
+
+func TestLoudnessRange(t *testing.T) {
+	// EBU Tech 3342 case 1: 20 s at -20 dBFS then 20 s at -30 dBFS spans 10 LU
+	got := measure(48000, 2, segment{-20, 20}, segment{-30, 20})
+	near(t, "Range", got.Range, 10, 0.1)
+}
@@ -0,0 +1,262 @@
+package audio
+
+import (
+	"math"
+	"math/cmplx"
+	"sort"
+
+	"prodhub-backend/music"
+)
+
+// Analysis settings for tempo and key detection
+const (
+	spectrumSize = 4096 // FFT frame, about 93 ms at 44.1 kHz
+	spectrumHop  = 512  // Onset envelope resolution, about 11.6 ms
+	minTempo     = 60.0
+	maxTempo     = 200.0
+	tempoPrior   = 120.0 // Most likely tempo before looking at the audio
+	chromaLow    = 55.0  // Lowest frequency counted towards the chroma, A1
+	chromaHigh   = 2000.0
+)
+
+// Krumhansl-Kessler key profiles, starting at the tonic
+var (
+	majorProfile = [12]float64{6.35, 2.23, 3.48, 2.33, 4.38, 4.09, 2.52, 5.19, 2.39, 3.66, 2.29, 2.88}
+	minorProfile = [12]float64{6.33, 2.68, 3.52, 5.38, 2.60, 3.53, 2.54, 4.75, 3.98, 2.69, 3.34, 3.17}
+)
+
+// MusicEstimate is the tempo and key heard in a stream. Confidences run from
+// 0, a guess, to 1, unambiguous.
+type MusicEstimate struct {
+	BPM           float64
+	BPMConfidence float64
+	Key           music.Key
+	KeyConfidence float64
+}
+
+// MusicDetector is a Sink estimating tempo from an onset envelope and key
+// from a chroma profile. Both come from the same short-time spectrum of the
+// channels folded to mono.
+type MusicDetector struct {
+	sampleRate int
+	window     []float64
+	frame      []float64 // Mono samples waiting for the next spectrum
+	spectrum   []complex128
+
+	previous []float64 // Log magnitudes of the previous frame
+	onsets   []float64 // Spectral flux per hop
+	chroma   [12]float64
+	binPitch []int // Pitch class of each FFT bin, -1 when outside the chroma range
+}
+
+// NewMusicDetector returns a MusicDetector for a stream of the given format
+func NewMusicDetector(format Format) *MusicDetector {
+	d := &MusicDetector{
+		sampleRate: format.SampleRate,
+		window:     hann(spectrumSize),
+		frame:      make([]float64, 0, spectrumSize+readFrames),
+		spectrum:   make([]complex128, spectrumSize),
+		previous:   make([]float64, spectrumSize/2),
+		binPitch:   make([]int, spectrumSize/2),
+	}
+	for bin := range d.binPitch {
+		freq := float64(bin) * float64(format.SampleRate) / spectrumSize
+		d.binPitch[bin] = -1
+		if freq >= chromaLow && freq <= chromaHigh {
+			// MIDI note 69 is A4 at 440 Hz; pitch class 0 is C
+			note := int(math.Round(69 + 12*math.Log2(freq/440)))
+			d.binPitch[bin] = note % 12
+		}
+	}
+	return d
+}
+
+func (d *MusicDetector) Write(block [][]float64) {
+	scale := 1 / float64(len(block))
+	for i := range block[0] {
+		sum := 0.0
+		for ch := range block {
+			sum += block[ch][i]
+		}
+		d.frame = append(d.frame, sum*scale)
+		if len(d.frame) == spectrumSize {
+			d.analyzeFrame()
+			d.frame = append(d.frame[:0], d.frame[spectrumHop:]...)
+		}
+	}
+}
+
+// analyzeFrame adds one spectrum to the onset envelope and the chroma
+func (d *MusicDetector) analyzeFrame() {
+	for i, v := range d.frame {
+		d.spectrum[i] = complex(v*d.window[i], 0)
+	}
+	fft(d.spectrum)
+
+	flux := 0.0
+	for bin := range d.previous {
+		magnitude := cmplx.Abs(d.spectrum[bin])
+		// Log compression keeps quiet hi-hats from drowning under the kick
+		logMagnitude := math.Log1p(100 * magnitude)
+		if rise := logMagnitude - d.previous[bin]; rise > 0 {
+			flux += rise
+		}
+		d.previous[bin] = logMagnitude
+		if pitch := d.binPitch[bin]; pitch >= 0 {
+			d.chroma[pitch] += magnitude
+		}
+	}
+	d.onsets = append(d.onsets, flux)
+}
+
+// Estimate returns the tempo and key of everything written so far
+func (d *MusicDetector) Estimate() MusicEstimate {
+	var estimate MusicEstimate
+	estimate.BPM, estimate.BPMConfidence = d.tempo()
+	estimate.Key, estimate.KeyConfidence = d.key()
+	return estimate
+}
+
+// tempo autocorrelates the onset envelope and picks the strongest period in
+// the tempo range, weighted towards common tempos and backed by its double
+func (d *MusicDetector) tempo() (float64, float64) {
+	rate := float64(d.sampleRate) / spectrumHop
+	minLag := int(math.Floor(rate * 60 / maxTempo))
+	maxLag := int(math.Ceil(rate * 60 / minTempo))
+	if len(d.onsets) < 2*maxLag+1 {
+		return 0, 0
+	}
+
+	// Remove the local mean so sustained sound does not read as rhythm
+	envelope := make([]float64, len(d.onsets))
+	const smooth = 16
+	for i := range d.onsets {
+		lo, hi := max(0, i-smooth), min(len(d.onsets), i+smooth+1)
+		mean := 0.0
+		for _, v := range d.onsets[lo:hi] {
+			mean += v
+		}
+		mean /= float64(hi - lo)
+		envelope[i] = math.Max(0, d.onsets[i]-mean)
+	}
+
+	correlation := make([]float64, 2*maxLag+1)
+	for lag := range correlation {
+		sum := 0.0
+		for i := lag; i < len(envelope); i++ {
+			sum += envelope[i] * envelope[i-lag]
+		}
+		correlation[lag] = sum / float64(len(envelope)-lag)
+	}
+	if correlation[0] == 0 {
+		return 0, 0
+	}
+
+	scores := make([]float64, maxLag+1)
+	best := minLag
+	for lag := minLag; lag <= maxLag; lag++ {
+		bpm := rate * 60 / float64(lag)
+		// Log-normal prior over tempo, one octave wide
+		prior := math.Exp(-0.5 * math.Pow(math.Log2(bpm/tempoPrior), 2))
+		scores[lag] = (correlation[lag] + 0.5*correlation[2*lag]) * prior
+		if scores[lag] > scores[best] {
+			best = lag
+		}
+	}
+
+	// Refine the period between lags with a parabola through the peak
+	period := float64(best)
+	if best > minLag && best < maxLag {
+		a, b, c := scores[best-1], scores[best], scores[best+1]
+		if denom := a - 2*b + c; denom < 0 {
+			period += 0.5 * (a - c) / denom
+		}
+	}
+	bpm := math.Round(rate*60/period*10) / 10
+
+	// Confidence is how far the peak stands above the typical score
+	sorted := append([]float64(nil), scores[minLag:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+	confidence := 0.0
+	if scores[best] > 0 {
+		confidence = (scores[best] - median) / scores[best]
+	}
+	return bpm, clamp01(confidence)
+}
+
+// key correlates the chroma with every rotation of the major and minor
+// profiles. Confidence grows with the margin over the runner-up, not counting
+// the relative key, which shares the same notes.
+func (d *MusicDetector) key() (music.Key, float64) {
+	total := 0.0
+	for _, v := range d.chroma {
+		total += v
+	}
+	if total == 0 {
+		return music.Key{}, 0
+	}
+
+	type candidate struct {
+		key   music.Key
+		score float64
+	}
+	candidates := make([]candidate, 0, 24)
+	for tonic := 0; tonic < 12; tonic++ {
+		for _, mode := range []music.Mode{music.Major, music.Minor} {
+			profile := majorProfile
+			if mode == music.Minor {
+				profile = minorProfile
+			}
+			var rotated [12]float64
+			for i := range rotated {
+				rotated[(tonic+i)%12] = profile[i]
+			}
+			candidates = append(candidates, candidate{
+				key:   music.Key{Tonic: tonic, Mode: mode},
+				score: pearson(d.chroma[:], rotated[:]),
+			})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+
+	best := candidates[0]
+	runnerUp := -1.0
+	for _, c := range candidates[1:] {
+		if c.key != best.key.Relative() {
+			runnerUp = c.score
+			break
+		}
+	}
+	// A margin of 0.2 in correlation is already a clear call
+	confidence := clamp01(best.score) * clamp01((best.score-runnerUp)/0.2)
+	return best.key, confidence
+}
+
+// pearson returns the correlation coefficient of two equally long series
+func pearson(x, y []float64) float64 {
+	n := float64(len(x))
+	var mx, my float64
+	for i := range x {
+		mx += x[i]
+		my += y[i]
+	}
+	mx /= n
+	my /= n
+
+	var sxy, sxx, syy float64
+	for i := range x {
+		dx, dy := x[i]-mx, y[i]-my
+		sxy += dx * dy
+		sxx += dx * dx
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return 0
+	}
+	return sxy / math.Sqrt(sxx*syy)
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
@@ -0,0 +1,129 @@
+package audio
+
+import "math"
+
+// Zoom levels of a waveform, as frames per peak. Each level is built from the
+// one before it, so every entry must divide the next.
+var PeakLevels = []int{256, 1024, 4096, 16384}
+
+// PeakLevel holds the lowest and highest sample of each window of a waveform
+type PeakLevel struct {
+	SamplesPerPeak int       `json:"samplesPerPeak"`
+	Min            []float32 `json:"min"`
+	Max            []float32 `json:"max"`
+}
+
+// Peaks is the waveform of a stream at several zoom levels. The channels are
+// folded together, so a peak covers the loudest of them.
+type Peaks struct {
+	SampleRate int         `json:"sampleRate"`
+	Channels   int         `json:"channels"`
+	Frames     int64       `json:"frames"`
+	Duration   float64     `json:"duration"`
+	Levels     []PeakLevel `json:"levels"`
+}
+
+// PeakBuilder is a Sink that collects the waveform of a stream
+type PeakBuilder struct {
+	format   Format
+	frames   int64
+	base     PeakLevel
+	lo, hi   float64
+	inWindow int
+}
+
+// NewPeakBuilder returns a PeakBuilder for a stream of the given format
+func NewPeakBuilder(format Format) *PeakBuilder {
+	return &PeakBuilder{
+		format: format,
+		base:   PeakLevel{SamplesPerPeak: PeakLevels[0], Min: []float32{}, Max: []float32{}},
+		lo:     math.Inf(1),
+		hi:     math.Inf(-1),
+	}
+}
+
+func (p *PeakBuilder) Write(block [][]float64) {
+	finest := p.base.SamplesPerPeak
+	for i := range block[0] {
+		for ch := range block {
+			v := block[ch][i]
+			p.lo = math.Min(p.lo, v)
+			p.hi = math.Max(p.hi, v)
+		}
+		p.inWindow++
+		if p.inWindow == finest {
+			p.flush()
+		}
+	}
+	p.frames += int64(len(block[0]))
+}
+
+func (p *PeakBuilder) flush() {
+	p.base.Min = append(p.base.Min, roundPeak(p.lo))
+	p.base.Max = append(p.base.Max, roundPeak(p.hi))
+	p.lo, p.hi = math.Inf(1), math.Inf(-1)
+	p.inWindow = 0
+}
+
+// Peaks returns the waveform of everything written so far
+func (p *PeakBuilder) Peaks() *Peaks {
+	if p.inWindow > 0 {
+		p.flush()
+	}
+
+	levels := []PeakLevel{p.base}
+	for _, size := range PeakLevels[1:] {
+		levels = append(levels, coarsen(levels[len(levels)-1], size))
+	}
+	return &Peaks{
+		SampleRate: p.format.SampleRate,
+		Channels:   p.format.Channels,
+		Frames:     p.frames,
+		Duration:   float64(p.frames) / float64(p.format.SampleRate),
+		Levels:     levels,
+	}
+}
+
+// ComputePeaks decodes the whole stream and returns its waveform
+func ComputePeaks(d Decoder) (*Peaks, error) {
+	builder := NewPeakBuilder(d.Format())
+	if _, err := Analyze(d, builder); err != nil {
+		return nil, err
+	}
+	return builder.Peaks(), nil
+}
+
+// coarsen merges the windows of a level into windows of size frames
+func coarsen(level PeakLevel, size int) PeakLevel {
+	group := size / level.SamplesPerPeak
+	out := PeakLevel{
+		SamplesPerPeak: size,
+		Min:            make([]float32, 0, len(level.Min)/group+1),
+		Max:            make([]float32, 0, len(level.Max)/group+1),
+	}
+	for start := 0; start < len(level.Min); start += group {
+		end := start + group
+		if end > len(level.Min) {
+			end = len(level.Min)
+		}
+		lo, hi := level.Min[start], level.Max[start]
+		for i := start + 1; i < end; i++ {
+			if level.Min[i] < lo {
+				lo = level.Min[i]
+			}
+			if level.Max[i] > hi {
+				hi = level.Max[i]
+			}
+		}
+		out.Min = append(out.Min, lo)
+		out.Max = append(out.Max, hi)
+	}
+	return out
+}
+
+// roundPeak clamps a sample to [-1, 1] and keeps four decimals, which is
+// finer than any screen can draw and keeps the JSON small
+func roundPeak(v float64) float32 {
+	v = math.Max(-1, math.Min(1, v))
+	return float32(math.Round(v*10000) / 10000)
+}
@@ -0,0 +1,198 @@
+package audio
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// WAVE format tags
+const (
+	wavePCM        = 0x0001
+	waveFloat      = 0x0003
+	waveExtensible = 0xfffe
+)
+
+// Header chunks are read into memory, so their size is bounded before
+// anything is allocated. A format chunk is at most 40 bytes with its
+// extension and a ds64 chunk 28 bytes plus an optional table.
+const (
+	maxFormatChunk = 1 << 10
+	maxDS64Chunk   = 1 << 10
+)
+
+// maxChannels bounds the channel count, which sizes the decode buffers
+const maxChannels = 64
+
+type wavDecoder struct {
+	r          io.Reader
+	format     Format
+	float      bool
+	width      int   // Bytes per sample
+	blockAlign int   // Bytes per frame
+	remaining  int64 // Bytes of sample data left
+	raw        []byte
+}
+
+func newWAVDecoder(r io.Reader) (*wavDecoder, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, ErrInvalidData
+	}
+	if string(header[8:12]) != "WAVE" {
+		return nil, ErrUnsupportedFormat
+	}
+	rf64 := string(header[0:4]) == "RF64"
+
+	d := &wavDecoder{r: r}
+	var dataSize64 int64 = -1
+	haveFormat := false
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return nil, ErrInvalidData
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		switch id {
+		case "fmt ":
+			if size > maxFormatChunk {
+				return nil, ErrInvalidData
+			}
+			body := make([]byte, size)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return nil, ErrInvalidData
+			}
+			if err := d.readFormat(body); err != nil {
+				return nil, err
+			}
+			haveFormat = true
+		case "ds64":
+			if size < 16 || size > maxDS64Chunk {
+				return nil, ErrInvalidData
+			}
+			body := make([]byte, size)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return nil, ErrInvalidData
+			}
+			dataSize64 = int64(binary.LittleEndian.Uint64(body[8:16]))
+		case "data":
+			if !haveFormat {
+				return nil, ErrInvalidData
+			}
+			if rf64 && size == 0xffffffff && dataSize64 >= 0 {
+				size = dataSize64
+			}
+			d.remaining = size
+			d.format.Frames = size / int64(d.blockAlign)
+			return d, nil
+		default:
+			if _, err := io.CopyN(io.Discard, r, size); err != nil {
+				return nil, ErrInvalidData
+			}
+		}
+		// Chunks are padded to an even size
+		if size%2 == 1 {
+			if _, err := io.CopyN(io.Discard, r, 1); err != nil {
+				return nil, ErrInvalidData
+			}
+		}
+	}
+}
+
+func (d *wavDecoder) readFormat(body []byte) error {
+	if len(body) < 16 {
+		return ErrInvalidData
+	}
+	tag := binary.LittleEndian.Uint16(body[0:2])
+	channels := int(binary.LittleEndian.Uint16(body[2:4]))
+	sampleRate := int(binary.LittleEndian.Uint32(body[4:8]))
+	blockAlign := int(binary.LittleEndian.Uint16(body[12:14]))
+	bits := int(binary.LittleEndian.Uint16(body[14:16]))
+	if tag == waveExtensible {
+		if len(body) < 26 {
+			return ErrInvalidData
+		}
+		// The first two bytes of the sub-format GUID hold the real format tag
+		tag = binary.LittleEndian.Uint16(body[24:26])
+	}
+	if channels == 0 || channels > maxChannels || sampleRate == 0 || blockAlign == 0 || blockAlign%channels != 0 {
+		return ErrInvalidData
+	}
+
+	width := blockAlign / channels
+	switch {
+	case tag == wavePCM && width >= 1 && width <= 4:
+	case tag == waveFloat && (width == 4 || width == 8):
+		d.float = true
+	default:
+		return ErrUnsupportedFormat
+	}
+
+	d.width = width
+	d.blockAlign = blockAlign
+	d.format = Format{SampleRate: sampleRate, Channels: channels, BitDepth: bits}
+	return nil
+}
+
+func (d *wavDecoder) Format() Format {
+	return d.format
+}
+
+func (d *wavDecoder) Read(buf [][]float64) (int, error) {
+	frames := int64(len(buf[0]))
+	if left := d.remaining / int64(d.blockAlign); left < frames {
+		frames = left
+	}
+	if frames == 0 {
+		return 0, io.EOF
+	}
+
+	size := int(frames) * d.blockAlign
+	if cap(d.raw) < size {
+		d.raw = make([]byte, size)
+	}
+	raw := d.raw[:size]
+	n, err := io.ReadFull(d.r, raw)
+	if err != nil {
+		// A truncated file still yields the frames that made it
+		d.remaining = 0
+		frames = int64(n / d.blockAlign)
+		if frames == 0 {
+			return 0, io.EOF
+		}
+	} else {
+		d.remaining -= int64(size)
+	}
+
+	for i := 0; i < int(frames); i++ {
+		frame := raw[i*d.blockAlign:]
+		for ch := 0; ch < d.format.Channels; ch++ {
+			buf[ch][i] = d.sample(frame[ch*d.width:])
+		}
+	}
+	return int(frames), nil
+}
+
+// sample converts one little-endian sample to [-1, 1]
+func (d *wavDecoder) sample(b []byte) float64 {
+	if d.float {
+		if d.width == 8 {
+			return math.Float64frombits(binary.LittleEndian.Uint64(b))
+		}
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	}
+	switch d.width {
+	case 1:
+		// 8-bit WAVE is unsigned
+		return (float64(b[0]) - 128) / 128
+	case 2:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+	case 3:
+		v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+		return float64(v) / (1 << 23)
+	default:
+		return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+	}
+}
@@ -2,19 +2,26 @@ package config
 
 import (
 	"context"
+	"errors"
 	"log"
 	"os"
+	"strings"
 	"time"
 	
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"github.com/joho/godotenv"
+	"prodhub-backend/music"
 )
 
 var MongoDB *mongo.Client
 var RepoCollection *mongo.Collection
 var CounterCollection *mongo.Collection
+var DownloadCollection *mongo.Collection
+var UploadCollection *mongo.Collection
+var ObjectCollection *mongo.Collection
 
 func ConnectMongo()error{
 
@@ -40,6 +47,9 @@ func ConnectMongo()error{
 	database:=client.Database("prodhub")
 
 	CounterCollection = database.Collection("counters")
+	DownloadCollection = database.Collection("downloads")
+	UploadCollection = database.Collection("uploads")
+	ObjectCollection = database.Collection("objects")
 	log.Println("Connected to MongoDB")
 	return nil
 }
@@ -51,3 +61,355 @@ func DisconnectMongo() {
         log.Println("Disconnected from MongoDB")
     }
 }
+
+// MigrateCollaborators rewrites collaborators stored as plain user ID strings
+// into collaborator entries with the contributor role
+func MigrateCollaborators() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	filter := bson.M{"collaborators": bson.M{"$elemMatch": bson.M{"$type": "string"}}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"collaborators": bson.M{"$map": bson.M{
+			"input": "$collaborators",
+			"as":    "c",
+			"in": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{bson.M{"$type": "$$c"}, "string"}},
+				bson.M{"userId": "$$c", "role": "contributor", "addedAt": 0},
+				"$$c",
+			}},
+		}}}}},
+	}
+
+	result, err := RepoCollection.UpdateMany(ctx, filter, pipeline)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Migrated collaborators of %d repositories", result.ModifiedCount)
+	}
+	return nil
+}
+
+// MigrateDefaultBranch marks the "main" branch of repositories created before
+// branches had a default flag as their default branch
+func MigrateDefaultBranch() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	filter := bson.M{"branches.name": "main", "branches.isDefault": bson.M{"$ne": true}}
+	update := bson.M{"$set": bson.M{"branches.$[m].isDefault": true}}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"m.name": "main"}},
+	})
+	result, err := RepoCollection.UpdateMany(ctx, filter, update, opts)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Marked the default branch of %d repositories", result.ModifiedCount)
+	}
+	return nil
+}
+
+// EnsureIndexes creates the indexes behind repository lookups and the public
+// listing's filters and sort orders. Creating an existing index is a no-op.
+func EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	models := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "repoId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "ownerId", Value: 1}}},
+		// Sort orders of the listing, with the repo ID breaking ties for cursors
+		{Keys: bson.D{{Key: "public", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "repoId", Value: -1}}},
+		{Keys: bson.D{{Key: "public", Value: 1}, {Key: "updatedAt", Value: -1}, {Key: "repoId", Value: -1}}},
+		{Keys: bson.D{{Key: "public", Value: 1}, {Key: "likes", Value: -1}, {Key: "repoId", Value: -1}}},
+		// Filters of the listing
+		{Keys: bson.D{{Key: "public", Value: 1}, {Key: "description.genre", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "public", Value: 1}, {Key: "description.scale", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "public", Value: 1}, {Key: "description.bpm", Value: 1}}},
+		// Compatible key search
+		{Keys: bson.D{{Key: "public", Value: 1}, {Key: "description.camelot", Value: 1}, {Key: "updatedAt", Value: -1}}},
+		// Audio analysis finds assets, and the ones still pending, across repos
+		{Keys: bson.D{{Key: "branches.versions.assets.assetId", Value: 1}}},
+		{Keys: bson.D{{Key: "branches.versions.assets.audio.status", Value: 1}}},
+	}
+	if _, err := RepoCollection.Indexes().CreateMany(ctx, models); err != nil {
+		return err
+	}
+
+	downloads := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "repoId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}},
+	}
+	if _, err := DownloadCollection.Indexes().CreateMany(ctx, downloads); err != nil {
+		return err
+	}
+
+	uploads := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "uploadId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "expiresAt", Value: 1}}},
+	}
+	if _, err := UploadCollection.Indexes().CreateMany(ctx, uploads); err != nil {
+		return err
+	}
+
+	objects := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "checksum", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "objectKey", Value: 1}}},
+		{Keys: bson.D{{Key: "refs", Value: 1}, {Key: "releasedAt", Value: 1}}},
+	}
+	_, err := ObjectCollection.Indexes().CreateMany(ctx, objects)
+	return err
+}
+
+// MigrateCamelot fills in the Camelot code of repositories created before
+// key search stored it
+func MigrateCamelot() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	filter := bson.M{"description.camelot": bson.M{"$exists": false}}
+	opts := options.Find().SetProjection(bson.M{"repoId": 1, "description.scale": 1})
+	cursor, err := RepoCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var repo struct {
+			RepoID      string `bson:"repoId"`
+			Description struct {
+				Scale string `bson:"scale"`
+			} `bson:"description"`
+		}
+		if err := cursor.Decode(&repo); err != nil {
+			return err
+		}
+		set := bson.M{"description.camelot": music.CamelotOf(repo.Description.Scale)}
+		if _, err := RepoCollection.UpdateOne(ctx, bson.M{"repoId": repo.RepoID}, bson.M{"$set": set}); err != nil {
+			return err
+		}
+		migrated++
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if migrated > 0 {
+		log.Printf("Filled in the Camelot code of %d repositories", migrated)
+	}
+	return nil
+}
+
+// MigrateLikes fills in the like counter of repositories created before it
+// existed, counting the likes recorded on users
+func MigrateLikes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var counts []struct {
+		RepoID string
+		Likes  int
+	}
+	err := PostgresDB.Raw("SELECT unnest(liked_repos) AS repo_id, COUNT(*) AS likes FROM users GROUP BY repo_id").
+		Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+	var migrated int64
+	for _, count := range counts {
+		filter := bson.M{"repoId": count.RepoID, "likes": bson.M{"$exists": false}}
+		result, err := RepoCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"likes": count.Likes}})
+		if err != nil {
+			return err
+		}
+		migrated += result.ModifiedCount
+	}
+
+	// Whatever is left was never liked
+	result, err := RepoCollection.UpdateMany(ctx, bson.M{"likes": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"likes": 0}})
+	if err != nil {
+		return err
+	}
+	if migrated += result.ModifiedCount; migrated > 0 {
+		log.Printf("Backfilled like counts of %d repositories", migrated)
+	}
+	return nil
+}
+
+// MigrateStoredURLs drops the public URLs stored with uploads from before
+// objects became private. Entries that only had a URL get the object key read
+// from it, so they stay downloadable. A URL no key can be read from points
+// outside the bucket; it is kept as unresolvedUrl for a manual look, so the
+// migration stops matching once it has run.
+//
+// Each entry is updated on its own through array filters, so uploads and
+// merges made while the migration runs are left intact.
+func MigrateStoredURLs() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"versions.url": bson.M{"$exists": true}},
+		bson.M{"branches.versions.url": bson.M{"$exists": true}},
+		bson.M{"releases.assets.url": bson.M{"$exists": true}},
+	}}
+	projection := bson.M{"versions.url": 1, "branches.versions.url": 1, "releases.assets.url": 1}
+	cursor, err := RepoCollection.Find(ctx, filter, options.Find().SetProjection(projection))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	bucket := storedURLBucket()
+	migrated, unresolved := 0, 0
+	for cursor.Next(ctx) {
+		if bucket == "" {
+			return errors.New("BUCKET_NAME is not set, so stored URLs cannot be read")
+		}
+		var repo storedURLs
+		if err := cursor.Decode(&repo); err != nil {
+			return err
+		}
+		for _, rawURL := range repo.urls() {
+			key := objectKeyFromURL(rawURL, bucket)
+			if key == "" {
+				unresolved++
+			}
+			if err := replaceStoredURL(ctx, repo.ID, rawURL, key); err != nil {
+				return err
+			}
+		}
+		migrated++
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if migrated > 0 {
+		log.Printf("Removed stored file URLs from %d repositories", migrated)
+	}
+	if unresolved > 0 {
+		log.Printf("%d stored file URLs point outside the bucket and were kept as unresolvedUrl", unresolved)
+	}
+	return nil
+}
+
+// storedURLs holds the URLs a repository still stores with its files
+type storedURLs struct {
+	ID       interface{} `bson:"_id"`
+	Versions []urlEntry  `bson:"versions"`
+	Branches []struct {
+		Versions []urlEntry `bson:"versions"`
+	} `bson:"branches"`
+	Releases []struct {
+		Assets []urlEntry `bson:"assets"`
+	} `bson:"releases"`
+}
+
+type urlEntry struct {
+	URL string `bson:"url"`
+}
+
+// urls lists the distinct stored URLs
+func (r storedURLs) urls() []string {
+	entries := r.Versions
+	for _, branch := range r.Branches {
+		entries = append(entries, branch.Versions...)
+	}
+	for _, release := range r.Releases {
+		entries = append(entries, release.Assets...)
+	}
+	seen := map[string]bool{}
+	urls := []string{}
+	for _, entry := range entries {
+		if entry.URL != "" && !seen[entry.URL] {
+			seen[entry.URL] = true
+			urls = append(urls, entry.URL)
+		}
+	}
+	return urls
+}
+
+// urlArrays are the arrays whose entries may store a URL. Path addresses an
+// entry as $[e]; Parent is the array filter field picking the enclosing
+// elements that hold the URL.
+var urlArrays = []struct {
+	Field  string
+	Path   string
+	Parent string
+}{
+	{Field: "versions", Path: "versions.$[e]"},
+	{Field: "branches.versions", Path: "branches.$[b].versions.$[e]", Parent: "b.versions.url"},
+	{Field: "releases.assets", Path: "releases.$[r].assets.$[e]", Parent: "r.assets.url"},
+}
+
+// replaceStoredURL gives every entry of a repo storing rawURL the object key
+// read from it, or keeps the URL as unresolvedUrl when key is empty, and then
+// removes the url field. Both steps can be repeated safely.
+func replaceStoredURL(ctx context.Context, repoID interface{}, rawURL, key string) error {
+	field, value := "objectKey", key
+	if key == "" {
+		field, value = "unresolvedUrl", rawURL
+	}
+
+	for _, array := range urlArrays {
+		filter := bson.M{"_id": repoID, array.Field + ".url": rawURL}
+		parents := []interface{}{}
+		if array.Parent != "" {
+			parents = append(parents, bson.M{array.Parent: rawURL})
+		}
+		// An object key the entry already has is kept
+		set := bson.M{"e.url": rawURL}
+		if key != "" {
+			set["e.objectKey"] = bson.M{"$in": bson.A{"", nil}}
+		}
+		steps := []struct {
+			update bson.M
+			entry  bson.M
+		}{
+			{bson.M{"$set": bson.M{array.Path + "." + field: value}}, set},
+			{bson.M{"$unset": bson.M{array.Path + ".url": ""}}, bson.M{"e.url": rawURL}},
+		}
+		for _, step := range steps {
+			opts := options.Update().SetArrayFilters(options.ArrayFilters{
+				Filters: append([]interface{}{step.entry}, parents...),
+			})
+			if _, err := RepoCollection.UpdateOne(ctx, filter, step.update, opts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ObjectKeyFromURL reads the object key from a URL stored before objects
+// became private, or returns "" when the URL points elsewhere
+func ObjectKeyFromURL(rawURL string) string {
+	return objectKeyFromURL(rawURL, storedURLBucket())
+}
+
+// storedURLBucket is the bucket named in stored public URLs
+func storedURLBucket() string {
+	if BucketName != "" {
+		return BucketName
+	}
+	return os.Getenv("BUCKET_NAME")
+}
+
+// objectKeyFromURL reads the object key from a public Cloud Storage URL of
+// the form https://storage.googleapis.com/<bucket>/<key>. Those URLs were
+// built from the raw file name without escaping, so the key is whatever
+// follows the prefix, taken literally.
+func objectKeyFromURL(rawURL, bucket string) string {
+	if bucket == "" {
+		return ""
+	}
+	prefix := "https://storage.googleapis.com/" + bucket + "/"
+	if !strings.HasPrefix(rawURL, prefix) {
+		return ""
+	}
+	return strings.TrimPrefix(rawURL, prefix)
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"prodhub-backend/storage"
+)
+
+// Storage is the object store every upload goes through
+var Storage storage.Storage
+
+// InitStorage picks the object store from STORAGE_DRIVER ("firebase" or "local").
+// Firebase is the default so existing deployments keep working unchanged.
+func InitStorage() error {
+	godotenv.Load(".env")
+
+	driver := os.Getenv("STORAGE_DRIVER")
+	switch driver {
+	case "", "firebase", "gcs":
+		log.Println("Connecting to firebase")
+		if err := InitFirebase(); err != nil {
+			return err
+		}
+		Storage = storage.NewGCS(StorageClient)
+	case "local":
+		root := os.Getenv("LOCAL_STORAGE_PATH")
+		if root == "" {
+			root = "./uploads"
+		}
+		baseURL := os.Getenv("LOCAL_STORAGE_URL")
+		if baseURL == "" {
+			baseURL = "http://localhost:8080/files"
+		}
+		secret := os.Getenv("LOCAL_SIGNING_SECRET")
+		if secret == "" {
+			return fmt.Errorf("LOCAL_SIGNING_SECRET is not set in the environment variables")
+		}
+		local, err := storage.NewLocal(root, baseURL, []byte(secret))
+		if err != nil {
+			return err
+		}
+		Storage = local
+		log.Println("Using local storage in:", root)
+	default:
+		return fmt.Errorf("unknown STORAGE_DRIVER %q", driver)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"prodhub-backend/models/mongo"
+)
+
+// assetFields maps the multipart fields of a version upload to asset kinds.
+// "file" is the original single-file field; its kind is guessed from the name.
+var assetFields = map[string]string{
+	"file":    "",
+	"project": mongo.AssetProject,
+	"mixdown": mongo.AssetMixdown,
+	"stems":   mongo.AssetStem,
+	"samples": mongo.AssetSample,
+	"midi":    mongo.AssetMIDI,
+	"other":   mongo.AssetOther,
+}
+
+// assetFieldOrder keeps uploads in a stable order, project first
+var assetFieldOrder = []string{"project", "file", "mixdown", "stems", "samples", "midi", "other"}
+
+// assetFile is a file waiting to be uploaded as an asset
+type assetFile struct {
+	Header *multipart.FileHeader
+	Kind   string
+}
+
+// guessAssetKind picks an asset kind from a file name
+func guessAssetKind(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".flp":
+		return mongo.AssetProject
+	case ".mid", ".midi":
+		return mongo.AssetMIDI
+	case ".wav", ".mp3", ".flac", ".aif", ".aiff", ".ogg":
+		return mongo.AssetMixdown
+	}
+	return mongo.AssetOther
+}
+
+// collectAssetFiles lists the files of a version upload with their kinds
+func collectAssetFiles(form *multipart.Form) []assetFile {
+	files := []assetFile{}
+	for _, field := range assetFieldOrder {
+		for _, header := range form.File[field] {
+			kind := assetFields[field]
+			if kind == "" {
+				kind = guessAssetKind(header.Filename)
+			}
+			files = append(files, assetFile{Header: header, Kind: kind})
+		}
+	}
+	return files
+}
+
+// uploadedAsset is a stored file with the project metadata read from it
+type uploadedAsset struct {
+	Asset   mongo.Asset
+	Project *mongo.ProjectInfo
+	Saved   int64 // Bytes not written because the repo already stored identical contents
+}
+
+// uploadAsset stores one file and returns its asset record. Project files are
+// parsed first, and their metadata is returned alongside.
+func uploadAsset(f assetFile, repoID string) (uploadedAsset, error) {
+	file, err := f.Header.Open()
+	if err != nil {
+		return uploadedAsset{}, err
+	}
+	defer file.Close()
+
+	var uploaded uploadedAsset
+	if f.Kind == mongo.AssetProject && isProjectFile(f.Header.Filename) {
+		if uploaded.Project, err = readProjectInfo(file); err != nil {
+			return uploadedAsset{}, fmt.Errorf("%s: %w", f.Header.Filename, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
+
+	uploaded.Asset, uploaded.Saved, err = storeAsset(ctx, file, f.Header.Filename, f.Kind, repoID)
+	if err != nil {
+		return uploadedAsset{}, err
+	}
+	return uploaded, nil
+}
+
+// storeAsset stores r as a content-addressed object and describes it as an
+// asset. It also returns the bytes saved when repoID already stored the contents.
+func storeAsset(ctx context.Context, r io.ReadSeeker, name, kind, repoID string) (mongo.Asset, int64, error) {
+	content, err := storeContent(ctx, r, name)
+	if err != nil {
+		return mongo.Asset{}, 0, fmt.Errorf("failed to upload %s: %v", name, err)
+	}
+	return newAsset(content, name, kind), bytesSaved(content, repoID), nil
+}
+
+// newAsset describes stored contents as an asset of a version
+func newAsset(content storedContent, name, kind string) mongo.Asset {
+	asset := mongo.Asset{
+		AssetID:     uuid.New().String(),
+		Name:        name,
+		Kind:        kind,
+		ContentType: contentTypeFor(name),
+		Size:        content.Size,
+		Checksum:    content.Checksum,
+		ObjectKey:   content.ObjectKey,
+	}
+	if isAnalyzedAudio(kind, name) {
+		asset.Audio = &mongo.AudioInfo{Status: mongo.AudioPending}
+	}
+	return asset
+}
+
+// mainAsset returns the asset a version's object key points at: its project, or else its first file
+func mainAsset(assets []mongo.Asset) *mongo.Asset {
+	for i := range assets {
+		if assets[i].Kind == mongo.AssetProject {
+			return &assets[i]
+		}
+	}
+	if len(assets) > 0 {
+		return &assets[0]
+	}
+	return nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
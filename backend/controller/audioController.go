@@ -0,0 +1,331 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"prodhub-backend/audio"
+	"prodhub-backend/config"
+	"prodhub-backend/jobs"
+	"prodhub-backend/models/mongo"
+)
+
+var ErrAssetNotFound = errors.New("asset not found")
+
+// analyzedExtensions are the audio files analysis runs on. MP3 is accepted so
+// the asset is marked as unsupported instead of silently skipped.
+var analyzedExtensions = map[string]bool{
+	".wav":  true,
+	".wave": true,
+	".flac": true,
+	".mp3":  true,
+}
+
+// isAnalyzedAudio reports whether an asset gets waveform analysis
+func isAnalyzedAudio(kind, fileName string) bool {
+	switch kind {
+	case mongo.AssetMixdown, mongo.AssetStem, mongo.AssetSample:
+		return analyzedExtensions[strings.ToLower(filepath.Ext(fileName))]
+	}
+	return false
+}
+
+// peaksKey is where the waveform of an asset is stored
+func peaksKey(assetID string) string {
+	return "peaks/" + assetID + ".json"
+}
+
+// queuedAudio holds the IDs of assets waiting in or running on the job queue
+var queuedAudio sync.Map
+
+// queueAudioAnalysis schedules analysis of every pending audio asset. The
+// first mixdown is the version's main mix and is also measured for loudness,
+// tempo and key. Assets that cannot be queued stay pending and are picked up
+// again by ResumeAudioAnalysis.
+func queueAudioAnalysis(repoID string, assets []mongo.Asset) {
+	measured := false
+	for _, asset := range assets {
+		if asset.Audio == nil || asset.Audio.Status != mongo.AudioPending {
+			continue
+		}
+		asset := asset
+		mainMix := !measured && asset.Kind == mongo.AssetMixdown
+		measured = measured || mainMix
+
+		if _, queued := queuedAudio.LoadOrStore(asset.AssetID, true); queued {
+			continue
+		}
+		err := jobs.Enqueue(jobs.Job{
+			Name: "audio analysis of " + asset.AssetID,
+			Run: func(ctx context.Context) error {
+				defer queuedAudio.Delete(asset.AssetID)
+				return analyzeAsset(ctx, repoID, asset, mainMix)
+			},
+		})
+		if err != nil {
+			queuedAudio.Delete(asset.AssetID)
+			log.Printf("Failed to queue analysis of asset %s, will retry: %v", asset.AssetID, err)
+		}
+	}
+}
+
+// ResumeAudioAnalysis queues the pending assets of every repository now and
+// then every interval. The queue only lives in memory, so this picks up work
+// lost to a restart or to a full queue.
+func ResumeAudioAnalysis(interval time.Duration) {
+	for {
+		if err := queuePendingAudio(); err != nil {
+			log.Printf("Failed to queue pending audio analysis: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func queuePendingAudio() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	filter := bson.M{"branches.versions.assets.audio.status": mongo.AudioPending}
+	opts := options.Find().SetProjection(bson.M{"repoId": 1, "branches.versions.assets": 1})
+	cursor, err := config.RepoCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var repo mongo.Repo
+		if err := cursor.Decode(&repo); err != nil {
+			return err
+		}
+		for _, branch := range repo.Branches {
+			for _, version := range branch.Versions {
+				queueAudioAnalysis(repo.RepoID, version.Assets)
+			}
+		}
+	}
+	return cursor.Err()
+}
+
+// mixAnalysis holds what is measured on a version's main mix
+type mixAnalysis struct {
+	Loudness *mongo.Loudness
+	Music    *mongo.MusicAnalysis
+}
+
+// analyzeAsset decodes an audio asset, stores its waveform peaks and records
+// the result on every copy of the asset in the repository
+func analyzeAsset(ctx context.Context, repoID string, asset mongo.Asset, mainMix bool) error {
+	info, mix, err := computeAudioInfo(ctx, asset, mainMix)
+	if err != nil {
+		info = &mongo.AudioInfo{Status: mongo.AudioFailed, Error: err.Error()}
+		if errors.Is(err, audio.ErrUnsupportedFormat) {
+			info.Status = mongo.AudioUnsupported
+		}
+	}
+
+	versionFields := bson.M{}
+	if mix != nil {
+		versionFields["loudness"] = mix.Loudness
+		if mix.Music != nil {
+			if err := checkDetectedMusic(ctx, repoID, mix.Music); err != nil {
+				return err
+			}
+			versionFields["music"] = mix.Music
+		}
+	}
+	if err := setAudioInfo(ctx, asset.AssetID, info, versionFields); err != nil {
+		return err
+	}
+	return err
+}
+
+// computeAudioInfo decodes an asset once, building its waveform and, for a
+// main mix, measuring its loudness, tempo and key
+func computeAudioInfo(ctx context.Context, asset mongo.Asset, mainMix bool) (*mongo.AudioInfo, *mixAnalysis, error) {
+	reader, err := config.Storage.Get(ctx, asset.ObjectKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch audio: %v", err)
+	}
+	defer reader.Close()
+
+	decoder, err := audio.NewDecoder(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	peakBuilder := audio.NewPeakBuilder(decoder.Format())
+	sinks := []audio.Sink{peakBuilder}
+	var meter *audio.LoudnessMeter
+	var detector *audio.MusicDetector
+	if mainMix {
+		meter = audio.NewLoudnessMeter(decoder.Format())
+		detector = audio.NewMusicDetector(decoder.Format())
+		sinks = append(sinks, meter, detector)
+	}
+	if _, err := audio.Analyze(decoder, sinks...); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode audio: %v", err)
+	}
+
+	peaks := peakBuilder.Peaks()
+	data, err := json.Marshal(peaks)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := peaksKey(asset.AssetID)
+	if _, err := config.Storage.Put(ctx, key, bytes.NewReader(data), "application/json"); err != nil {
+		return nil, nil, fmt.Errorf("failed to store peaks: %v", err)
+	}
+
+	info := &mongo.AudioInfo{
+		Status:     mongo.AudioReady,
+		Duration:   peaks.Duration,
+		SampleRate: peaks.SampleRate,
+		Channels:   peaks.Channels,
+		PeaksKey:   key,
+	}
+	if !mainMix {
+		return info, nil, nil
+	}
+
+	levels := meter.Loudness()
+	mix := &mixAnalysis{
+		Loudness: &mongo.Loudness{
+			AssetID:      asset.AssetID,
+			Integrated:   roundLevel(levels.Integrated),
+			ShortTermMax: roundLevel(levels.ShortTermMax),
+			Range:        roundLevel(levels.Range),
+			SamplePeak:   roundLevel(levels.SamplePeak),
+			TruePeak:     roundLevel(levels.TruePeak),
+			RMS:          roundLevel(levels.RMS),
+		},
+	}
+	if estimate := detector.Estimate(); estimate.BPM > 0 {
+		mix.Music = &mongo.MusicAnalysis{
+			AssetID:       asset.AssetID,
+			BPM:           estimate.BPM,
+			BPMConfidence: roundLevel(estimate.BPMConfidence),
+			Key:           estimate.Key.String(),
+			Camelot:       estimate.Key.CamelotCode(),
+			KeyConfidence: roundLevel(estimate.KeyConfidence),
+		}
+	}
+	return info, mix, nil
+}
+
+// roundLevel keeps two decimals, as far as any meter reads
+func roundLevel(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// setAudioInfo updates an asset wherever it appears, and sets versionFields
+// on the versions holding it. Merges copy versions between branches and forks
+// copy them between repositories, so the same asset can live in several places.
+func setAudioInfo(ctx context.Context, assetID string, info *mongo.AudioInfo, versionFields bson.M) error {
+	filter := bson.M{"branches.versions.assets.assetId": assetID}
+	setData := bson.M{"branches.$[b].versions.$[v].assets.$[a].audio": info}
+	for field, value := range versionFields {
+		setData["branches.$[b].versions.$[v]."+field] = value
+	}
+	update := bson.M{"$set": setData}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{
+			bson.M{"b.versions.assets.assetId": assetID},
+			bson.M{"v.assets.assetId": assetID},
+			bson.M{"a.assetId": assetID},
+		},
+	})
+	_, err := config.RepoCollection.UpdateMany(ctx, filter, update, opts)
+	return err
+}
+
+// LoudnessPoint is one measured version in the mastering history of a branch
+type LoudnessPoint struct {
+	VersionID string
+	CreatedAt int64
+	mongo.Loudness
+	IntegratedChange float64 // LU against the previous measured version
+	TruePeakChange   float64 // dB against the previous measured version
+}
+
+// loudnessHistory lists the measured versions of a branch, oldest first
+func loudnessHistory(versions []mongo.Version) []LoudnessPoint {
+	history := []LoudnessPoint{}
+	for _, version := range versions {
+		if version.Loudness == nil {
+			continue
+		}
+		point := LoudnessPoint{
+			VersionID: version.VersionID,
+			CreatedAt: version.CreatedAt,
+			Loudness:  *version.Loudness,
+		}
+		if len(history) > 0 {
+			previous := history[len(history)-1]
+			point.IntegratedChange = roundLevel(point.Integrated - previous.Integrated)
+			point.TruePeakChange = roundLevel(point.TruePeak - previous.TruePeak)
+		}
+		history = append(history, point)
+	}
+	return history
+}
+
+// findAsset returns an asset of a version by ID
+func findAsset(version *mongo.Version, assetID string) *mongo.Asset {
+	for i := range version.Assets {
+		if version.Assets[i].AssetID == assetID {
+			return &version.Assets[i]
+		}
+	}
+	return nil
+}
+
+// GetAssetPeaks serves the waveform peaks of an audio asset. It answers 202
+// while the analysis is still running.
+func GetAssetPeaks(c *gin.Context) {
+	repo := c.MustGet("repo").(mongo.Repo)
+
+	version := findVersion(&repo, c.Param("versionId"))
+	if version == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrVersionNotFound)
+		return
+	}
+	asset := findAsset(version, c.Param("assetId"))
+	if asset == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrAssetNotFound)
+		return
+	}
+	if asset.Audio == nil {
+		sendErrorResponse(c, http.StatusNotFound, errors.New("asset has no waveform"))
+		return
+	}
+
+	switch asset.Audio.Status {
+	case mongo.AudioPending:
+		c.JSON(http.StatusAccepted, gin.H{"status": asset.Audio.Status})
+		return
+	case mongo.AudioFailed, mongo.AudioUnsupported:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"status": asset.Audio.Status, "error": asset.Audio.Error})
+		return
+	}
+
+	reader, err := config.Storage.Get(c.Request.Context(), asset.Audio.PeaksKey)
+	if err != nil {
+		sendErrorResponse(c, http.StatusInternalServerError, errors.New("failed to load peaks"))
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, -1, "application/json", reader, nil)
+}
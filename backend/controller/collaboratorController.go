@@ -0,0 +1,366 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/gorm"
+	"prodhub-backend/config"
+	"prodhub-backend/helpers"
+	"prodhub-backend/models/mongo"
+	"prodhub-backend/models/postgres"
+)
+
+type InvitationInput struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role" binding:"omitempty,oneof=viewer contributor maintainer"`
+}
+
+type CollaboratorRoleInput struct {
+	Role string `json:"role" binding:"required,oneof=viewer contributor maintainer"`
+}
+
+var (
+	ErrInvitationNotFound = errors.New("invitation not found")
+	// ErrMaintainersOwnerOnly keeps maintainers from appointing, demoting or
+	// removing each other
+	ErrMaintainersOwnerOnly = errors.New("only the owner can appoint, change or remove maintainers")
+)
+
+// findUserByNameOrEmail looks up the user an invitation or transfer is addressed to
+func findUserByNameOrEmail(username, email string) (*postgres.User, error) {
+	var user postgres.User
+	query := config.PostgresDB
+	switch {
+	case username != "":
+		query = query.Where("username = ?", username)
+	case email != "":
+		query = query.Where("email = ?", email)
+	default:
+		return nil, ErrInvalidInput
+	}
+	if err := query.First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, ErrDatabaseOp
+	}
+	return &user, nil
+}
+
+// Invite a user to collaborate on a Repository
+func InviteCollaborator(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repoID := c.Param("id")
+	userID, _ := c.Get("userID")
+
+	var input InvitationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		sendErrorResponse(c, http.StatusBadRequest, ErrInvalidInput)
+		return
+	}
+
+	invitee, err := findUserByNameOrEmail(input.Username, input.Email)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == ErrUserNotFound {
+			status = http.StatusNotFound
+		} else if err == ErrInvalidInput {
+			status = http.StatusBadRequest
+		}
+		sendErrorResponse(c, status, err)
+		return
+	}
+
+	repo := c.MustGet("repo").(mongo.Repo)
+	if invitee.UserID == repo.OwnerId || helpers.FindCollaborator(repo.Collaborators, invitee.UserID) != nil {
+		sendErrorResponse(c, http.StatusConflict, errors.New("user is already a member of this repository"))
+		return
+	}
+
+	if input.Role == "" {
+		input.Role = mongo.RoleContributor
+	}
+	if input.Role == mongo.RoleMaintainer && c.MustGet("repoAccess").(helpers.Access) < helpers.AccessOwner {
+		sendErrorResponse(c, http.StatusForbidden, ErrMaintainersOwnerOnly)
+		return
+	}
+
+	now := time.Now().Unix()
+	invitation := mongo.Invitation{
+		InvitationID: uuid.New().String(),
+		UserID:       invitee.UserID,
+		Username:     invitee.Username,
+		Role:         input.Role,
+		InvitedBy:    userID.(string),
+		Status:       mongo.InvitationPending,
+		CreatedAt:    now,
+	}
+
+	// Only one pending invitation per user
+	filter := bson.M{
+		"repoId": repoID,
+		"invitations": bson.M{"$not": bson.M{"$elemMatch": bson.M{
+			"userId": invitee.UserID,
+			"status": mongo.InvitationPending,
+		}}},
+	}
+	update := bson.M{
+		"$push": bson.M{
+			"invitations": invitation,
+			"activity":    mongo.Activity{Date: now, Description: fmt.Sprintf("Invited %s to collaborate as %s", invitee.Username, input.Role)},
+		},
+		"$set": bson.M{"updatedAt": now},
+	}
+	result, err := config.RepoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+	if result.MatchedCount == 0 {
+		sendErrorResponse(c, http.StatusConflict, errors.New("user already has a pending invitation"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, invitation)
+}
+
+// List the pending invitations of a Repository
+func GetRepoInvitations(c *gin.Context) {
+	repo := c.MustGet("repo").(mongo.Repo)
+
+	pending := []mongo.Invitation{}
+	for _, invitation := range repo.Invitations {
+		if invitation.Status == mongo.InvitationPending {
+			pending = append(pending, invitation)
+		}
+	}
+	c.JSON(http.StatusOK, pending)
+}
+
+// List the pending invitations addressed to the current user
+func GetMyInvitations(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	userID, _ := c.Get("userID")
+
+	filter := bson.M{"invitations": bson.M{"$elemMatch": bson.M{
+		"userId": userID,
+		"status": mongo.InvitationPending,
+	}}}
+	opts := options.Find().SetProjection(bson.M{"repoId": 1, "name": 1, "ownerId": 1, "invitations": 1})
+	cursor, err := config.RepoCollection.Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var repos []mongo.Repo
+	if err := cursor.All(ctx, &repos); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode invitations"})
+		return
+	}
+
+	invitations := []gin.H{}
+	for _, repo := range repos {
+		for _, invitation := range repo.Invitations {
+			if invitation.UserID == userID && invitation.Status == mongo.InvitationPending {
+				invitations = append(invitations, gin.H{
+					"repoId":     repo.RepoID,
+					"repoName":   repo.Name,
+					"ownerId":    repo.OwnerId,
+					"invitation": invitation,
+				})
+			}
+		}
+	}
+	c.JSON(http.StatusOK, invitations)
+}
+
+// Accept an invitation and join the Repository as a collaborator
+func AcceptInvitation(c *gin.Context) {
+	respondToInvitation(c, mongo.InvitationAccepted)
+}
+
+// Decline an invitation
+func DeclineInvitation(c *gin.Context) {
+	respondToInvitation(c, mongo.InvitationDeclined)
+}
+
+// respondToInvitation resolves a pending invitation addressed to the current user
+func respondToInvitation(c *gin.Context, status string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repoID := c.Param("id")
+	invitationID := c.Param("invitationId")
+	userID, _ := c.Get("userID")
+
+	var repo mongo.Repo
+	if err := config.RepoCollection.FindOne(ctx, bson.M{"repoId": repoID}).Decode(&repo); err != nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrInvitationNotFound)
+		return
+	}
+	var invitation *mongo.Invitation
+	for i := range repo.Invitations {
+		if repo.Invitations[i].InvitationID == invitationID && repo.Invitations[i].UserID == userID {
+			invitation = &repo.Invitations[i]
+		}
+	}
+	// Invitations for other users are reported as missing so they do not leak private repos
+	if invitation == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrInvitationNotFound)
+		return
+	}
+	if invitation.Status != mongo.InvitationPending {
+		sendErrorResponse(c, http.StatusConflict, fmt.Errorf("invitation was already %s", invitation.Status))
+		return
+	}
+
+	now := time.Now().Unix()
+	filter := bson.M{
+		"repoId": repoID,
+		"invitations": bson.M{"$elemMatch": bson.M{
+			"invitationId": invitationID,
+			"status":       mongo.InvitationPending,
+		}},
+	}
+	push := bson.M{"activity": mongo.Activity{
+		Date:        now,
+		Description: fmt.Sprintf("%s %s the invitation to collaborate", invitation.Username, status),
+	}}
+	if status == mongo.InvitationAccepted {
+		role := invitation.Role
+		if !mongo.ValidRole(role) {
+			role = mongo.RoleContributor
+		}
+		push["collaborators"] = mongo.Collaborator{UserID: invitation.UserID, Role: role, AddedAt: now}
+		// Never add the same user twice
+		filter["collaborators.userId"] = bson.M{"$ne": invitation.UserID}
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"invitations.$.status":      status,
+			"invitations.$.respondedAt": now,
+			"updatedAt":                 now,
+		},
+		"$push": push,
+	}
+
+	result, err := config.RepoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+	if result.MatchedCount == 0 {
+		sendErrorResponse(c, http.StatusConflict, errors.New("invitation is no longer pending"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation " + status})
+}
+
+// Remove a collaborator from a Repository
+func RemoveCollaborator(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repoID := c.Param("id")
+	collaboratorID := c.Param("userId")
+
+	repo := c.MustGet("repo").(mongo.Repo)
+	collaborator := helpers.FindCollaborator(repo.Collaborators, collaboratorID)
+	if collaborator == nil {
+		sendErrorResponse(c, http.StatusNotFound, errors.New("collaborator not found"))
+		return
+	}
+	if collaborator.Role == mongo.RoleMaintainer && c.MustGet("repoAccess").(helpers.Access) < helpers.AccessOwner {
+		sendErrorResponse(c, http.StatusForbidden, ErrMaintainersOwnerOnly)
+		return
+	}
+
+	now := time.Now().Unix()
+	update := bson.M{
+		"$pull": bson.M{"collaborators": bson.M{"userId": collaboratorID}},
+		"$push": bson.M{"activity": mongo.Activity{Date: now, Description: fmt.Sprintf("Removed collaborator %s", collaboratorID)}},
+		"$set":  bson.M{"updatedAt": now},
+	}
+	// The role checked above must still be the current one
+	filter := bson.M{
+		"repoId":        repoID,
+		"collaborators": bson.M{"$elemMatch": bson.M{"userId": collaboratorID, "role": collaborator.Role}},
+	}
+	result, err := config.RepoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+	if result.MatchedCount == 0 {
+		sendErrorResponse(c, http.StatusConflict, errors.New("collaborator changed; try again"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Collaborator removed successfully"})
+}
+
+// Change the role of a collaborator
+func UpdateCollaboratorRole(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repoID := c.Param("id")
+	collaboratorID := c.Param("userId")
+
+	var input CollaboratorRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		sendErrorResponse(c, http.StatusBadRequest, ErrInvalidInput)
+		return
+	}
+
+	// Only the owner appoints or changes maintainers, so maintainers cannot
+	// demote each other
+	repo := c.MustGet("repo").(mongo.Repo)
+	collaborator := helpers.FindCollaborator(repo.Collaborators, collaboratorID)
+	if collaborator == nil {
+		sendErrorResponse(c, http.StatusNotFound, errors.New("collaborator not found"))
+		return
+	}
+	maintainerChange := collaborator.Role == mongo.RoleMaintainer || input.Role == mongo.RoleMaintainer
+	if maintainerChange && c.MustGet("repoAccess").(helpers.Access) < helpers.AccessOwner {
+		sendErrorResponse(c, http.StatusForbidden, ErrMaintainersOwnerOnly)
+		return
+	}
+
+	now := time.Now().Unix()
+	// The role checked above must still be the current one
+	filter := bson.M{
+		"repoId":        repoID,
+		"collaborators": bson.M{"$elemMatch": bson.M{"userId": collaboratorID, "role": collaborator.Role}},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"collaborators.$.role": input.Role,
+			"updatedAt":            now,
+		},
+		"$push": bson.M{"activity": mongo.Activity{
+			Date:        now,
+			Description: fmt.Sprintf("Changed the role of %s to %s", collaboratorID, input.Role),
+		}},
+	}
+	result, err := config.RepoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+	if result.MatchedCount == 0 {
+		sendErrorResponse(c, http.StatusConflict, errors.New("collaborator changed; try again"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Collaborator role updated successfully"})
+}
@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"prodhub-backend/config"
+	"prodhub-backend/helpers"
+	"prodhub-backend/models/mongo"
+)
+
+type CommentInput struct {
+	Body      string                 `json:"body" binding:"required,min=1,max=5000"`
+	ParentID  string                 `json:"parentId"`
+	Timestamp *float64               `json:"timestamp" binding:"omitempty,min=0"`
+	Position  *mongo.MusicalPosition `json:"position"`
+}
+
+type ResolveCommentInput struct {
+	Resolved bool `json:"resolved"`
+}
+
+// CommentThread is a top-level comment with its replies
+type CommentThread struct {
+	mongo.VersionComment
+	Replies []*CommentThread
+}
+
+var ErrCommentNotFound = errors.New("comment not found")
+
+// commentThreads nests replies under their parent comments. Threads are ordered
+// by position in the track, unanchored ones last; replies oldest first.
+func commentThreads(comments []mongo.VersionComment) []*CommentThread {
+	nodes := map[string]*CommentThread{}
+	for _, comment := range comments {
+		nodes[comment.CommentID] = &CommentThread{VersionComment: comment, Replies: []*CommentThread{}}
+	}
+
+	threads := []*CommentThread{}
+	for _, comment := range comments {
+		node := nodes[comment.CommentID]
+		if parent, ok := nodes[comment.ParentID]; ok && comment.ParentID != "" {
+			parent.Replies = append(parent.Replies, node)
+		} else {
+			threads = append(threads, node)
+		}
+	}
+
+	sort.SliceStable(threads, func(i, j int) bool {
+		a, b := threads[i].Timestamp, threads[j].Timestamp
+		switch {
+		case a != nil && b != nil && *a != *b:
+			return *a < *b
+		case a != nil && b == nil:
+			return true
+		case a == nil && b != nil:
+			return false
+		}
+		return threads[i].CreatedAt < threads[j].CreatedAt
+	})
+	return threads
+}
+
+// Comment on a Version. Only repository members can leave feedback.
+func AddComment(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	versionID := c.Param("versionId")
+	userID, _ := c.Get("userID")
+	repo := c.MustGet("repo").(mongo.Repo)
+
+	if helpers.RepoRole(&repo, userID.(string)) == "" {
+		sendErrorResponse(c, http.StatusForbidden, errors.New("only repository members can comment"))
+		return
+	}
+
+	var input CommentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		sendErrorResponse(c, http.StatusBadRequest, ErrInvalidInput)
+		return
+	}
+	if input.Position != nil && (input.Position.Bar < 1 || input.Position.Beat < 1 || input.Position.Tick < 0) {
+		sendErrorResponse(c, http.StatusBadRequest, errors.New("bar and beat are counted from 1"))
+		return
+	}
+	if findVersion(&repo, versionID) == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrVersionNotFound)
+		return
+	}
+	if input.ParentID != "" {
+		parentFound := false
+		for _, comment := range repo.Comments {
+			if comment.CommentID == input.ParentID && comment.VersionID == versionID {
+				parentFound = true
+				break
+			}
+		}
+		if !parentFound {
+			sendErrorResponse(c, http.StatusNotFound, ErrCommentNotFound)
+			return
+		}
+	}
+
+	comment := mongo.VersionComment{
+		CommentID: uuid.New().String(),
+		VersionID: versionID,
+		ParentID:  input.ParentID,
+		AuthorID:  userID.(string),
+		Body:      input.Body,
+		Timestamp: input.Timestamp,
+		Position:  input.Position,
+		CreatedAt: time.Now().Unix(),
+	}
+	update := bson.M{"$push": bson.M{"comments": comment}}
+	if _, err := config.RepoCollection.UpdateOne(ctx, bson.M{"repoId": repo.RepoID}, update); err != nil {
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+	c.JSON(http.StatusCreated, comment)
+}
+
+// List the comment threads of a Version
+func GetVersionComments(c *gin.Context) {
+	versionID := c.Param("versionId")
+	repo := c.MustGet("repo").(mongo.Repo)
+
+	if findVersion(&repo, versionID) == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrVersionNotFound)
+		return
+	}
+
+	comments := []mongo.VersionComment{}
+	for _, comment := range repo.Comments {
+		if comment.VersionID == versionID {
+			comments = append(comments, comment)
+		}
+	}
+	c.JSON(http.StatusOK, commentThreads(comments))
+}
+
+// List the comment threads of every version in a Repository, optionally
+// filtered by ?resolved=true|false
+func GetRepoComments(c *gin.Context) {
+	repo := c.MustGet("repo").(mongo.Repo)
+	resolved := c.Query("resolved")
+
+	threads := []*CommentThread{}
+	for _, thread := range commentThreads(repo.Comments) {
+		if resolved == "" || (resolved == "true") == thread.Resolved {
+			threads = append(threads, thread)
+		}
+	}
+	c.JSON(http.StatusOK, threads)
+}
+
+// Mark a comment thread resolved or unresolved. The comment author and contributors may do this.
+func ResolveComment(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	commentID := c.Param("commentId")
+	userID, _ := c.Get("userID")
+	repo := c.MustGet("repo").(mongo.Repo)
+
+	var input ResolveCommentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		sendErrorResponse(c, http.StatusBadRequest, ErrInvalidInput)
+		return
+	}
+
+	var comment *mongo.VersionComment
+	for i := range repo.Comments {
+		if repo.Comments[i].CommentID == commentID {
+			comment = &repo.Comments[i]
+		}
+	}
+	if comment == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrCommentNotFound)
+		return
+	}
+	if comment.AuthorID != userID && helpers.RepoAccess(&repo, userID.(string)) < helpers.AccessContribute {
+		sendErrorResponse(c, http.StatusForbidden, errors.New("Access denied"))
+		return
+	}
+
+	set := bson.M{"comments.$.resolved": input.Resolved}
+	if input.Resolved {
+		set["comments.$.resolvedBy"] = userID
+		set["comments.$.resolvedAt"] = time.Now().Unix()
+	} else {
+		set["comments.$.resolvedBy"] = ""
+		set["comments.$.resolvedAt"] = 0
+	}
+	filter := bson.M{"repoId": repo.RepoID, "comments.commentId": commentID}
+	if _, err := config.RepoCollection.UpdateOne(ctx, filter, bson.M{"$set": set}); err != nil {
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Comment updated", "resolved": input.Resolved})
+}
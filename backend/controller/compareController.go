@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"prodhub-backend/config"
+	"prodhub-backend/flp"
+	"prodhub-backend/models/mongo"
+)
+
+var ErrVersionNotFound = errors.New("version not found")
+
+// findVersion looks a version up on the repo and all of its branches
+func findVersion(repo *mongo.Repo, versionID string) *mongo.Version {
+	for i := range repo.Versions {
+		if repo.Versions[i].VersionID == versionID {
+			return &repo.Versions[i]
+		}
+	}
+	for b := range repo.Branches {
+		for i := range repo.Branches[b].Versions {
+			if repo.Branches[b].Versions[i].VersionID == versionID {
+				return &repo.Branches[b].Versions[i]
+			}
+		}
+	}
+	return nil
+}
+
+// loadProject downloads the project file of a version and parses it. The
+// status tells a version without a readable project apart from storage failures.
+func loadProject(ctx context.Context, version *mongo.Version) (*flp.Project, int, error) {
+	if version.ObjectKey == "" {
+		return nil, http.StatusUnprocessableEntity, fmt.Errorf("version %s has no stored project file", version.VersionID)
+	}
+	reader, err := config.Storage.Get(ctx, version.ObjectKey)
+	if err != nil {
+		log.Printf("Failed to fetch project file of version %s: %v", version.VersionID, err)
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to fetch project file of version %s", version.VersionID)
+	}
+	defer reader.Close()
+
+	project, err := flp.Parse(reader)
+	if err != nil {
+		return nil, http.StatusUnprocessableEntity, fmt.Errorf("version %s is not a readable FL Studio project: %v", version.VersionID, err)
+	}
+	return project, 0, nil
+}
+
+// CompareVersions returns a structured diff between the project files of two versions
+func CompareVersions(c *gin.Context) {
+	repoID := c.Param("id")
+	fromID := c.Query("from")
+	toID := c.Query("to")
+	if fromID == "" || toID == "" {
+		sendErrorResponse(c, http.StatusBadRequest, errors.New("both from and to version IDs are required"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var repo mongo.Repo
+	if err := config.RepoCollection.FindOne(ctx, bson.M{"repoId": repoID}).Decode(&repo); err != nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrRepoNotFound)
+		return
+	}
+
+	fromVersion := findVersion(&repo, fromID)
+	toVersion := findVersion(&repo, toID)
+	if fromVersion == nil || toVersion == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrVersionNotFound)
+		return
+	}
+
+	fromProject, status, err := loadProject(ctx, fromVersion)
+	if err != nil {
+		sendErrorResponse(c, status, err)
+		return
+	}
+	toProject, status, err := loadProject(ctx, toVersion)
+	if err != nil {
+		sendErrorResponse(c, status, err)
+		return
+	}
+
+	diff := flp.Compare(fromProject, toProject)
+	c.JSON(http.StatusOK, gin.H{
+		"from":      fromID,
+		"to":        toID,
+		"identical": diff.Empty(),
+		"diff":      diff,
+	})
+}
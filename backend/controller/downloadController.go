@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"prodhub-backend/config"
+	"prodhub-backend/models/mongo"
+)
+
+// signedURLExpiry is how long a download link stays valid
+const signedURLExpiry = 5 * time.Minute
+
+// DownloadVersion sends a file of a version to a caller with read access.
+// The asset query parameter picks the file, the main file by default. With
+// mode=stream the file comes through the API; otherwise the caller is
+// redirected to a signed URL that expires within minutes.
+func DownloadVersion(c *gin.Context) {
+	repo := c.MustGet("repo").(mongo.Repo)
+
+	version := findVersion(&repo, c.Param("versionId"))
+	if version == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrVersionNotFound)
+		return
+	}
+
+	record := mongo.Download{RepoID: repo.RepoID, VersionID: version.VersionID, ObjectKey: version.ObjectKey}
+	if assetID := c.Query("asset"); assetID != "" {
+		asset := findAsset(version, assetID)
+		if asset == nil {
+			sendErrorResponse(c, http.StatusNotFound, ErrAssetNotFound)
+			return
+		}
+		record.AssetID, record.ObjectKey, record.FileName = asset.AssetID, asset.ObjectKey, asset.Name
+	} else if primary := mainAsset(version.Assets); primary != nil && primary.ObjectKey == version.ObjectKey {
+		record.AssetID, record.FileName = primary.AssetID, primary.Name
+	}
+	if record.ObjectKey == "" {
+		sendErrorResponse(c, http.StatusNotFound, errors.New("version has no stored file"))
+		return
+	}
+
+	sendObject(c, record)
+}
+
+// DownloadReleaseAsset sends a deliverable of a release, like DownloadVersion
+func DownloadReleaseAsset(c *gin.Context) {
+	repo := c.MustGet("repo").(mongo.Repo)
+
+	for _, release := range repo.Releases {
+		if release.ReleaseID != c.Param("releaseId") {
+			continue
+		}
+		for _, asset := range release.Assets {
+			if asset.Name == c.Param("assetName") && asset.ObjectKey != "" {
+				sendObject(c, mongo.Download{
+					RepoID:    repo.RepoID,
+					ReleaseID: release.ReleaseID,
+					ObjectKey: asset.ObjectKey,
+					FileName:  asset.Name,
+				})
+				return
+			}
+		}
+		sendErrorResponse(c, http.StatusNotFound, ErrAssetNotFound)
+		return
+	}
+	sendErrorResponse(c, http.StatusNotFound, ErrReleaseNotFound)
+}
+
+// sendObject redirects to a signed URL for the object, or streams it when
+// asked to or when the store cannot sign, and records the download
+func sendObject(c *gin.Context, record mongo.Download) {
+	if record.FileName == "" {
+		record.FileName = path.Base(record.ObjectKey)
+	}
+	userID, _ := c.Get("userID")
+	record.UserID = userID.(string)
+
+	if c.Query("mode") != mongo.DownloadStream {
+		signedURL, err := config.Storage.SignedURL(c.Request.Context(), record.ObjectKey, record.FileName, signedURLExpiry)
+		if err == nil {
+			record.Method = mongo.DownloadRedirect
+			recordDownload(record)
+			c.Redirect(http.StatusFound, signedURL)
+			return
+		}
+		log.Printf("Failed to sign URL for %s, streaming instead: %v", record.ObjectKey, err)
+	}
+
+	info, err := config.Storage.Stat(c.Request.Context(), record.ObjectKey)
+	if err != nil {
+		sendErrorResponse(c, http.StatusNotFound, errors.New("stored file not found"))
+		return
+	}
+	reader, err := config.Storage.Get(c.Request.Context(), record.ObjectKey)
+	if err != nil {
+		sendErrorResponse(c, http.StatusInternalServerError, errors.New("failed to read stored file"))
+		return
+	}
+	defer reader.Close()
+
+	record.Method = mongo.DownloadStream
+	recordDownload(record)
+	c.DataFromReader(http.StatusOK, info.Size, contentTypeFor(record.FileName), reader, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": record.FileName}),
+	})
+}
+
+// recordDownload stores a download for analytics. A failure is logged and
+// never keeps the caller from their file.
+func recordDownload(record mongo.Download) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	record.DownloadID = uuid.New().String()
+	record.CreatedAt = time.Now().Unix()
+	if _, err := config.DownloadCollection.InsertOne(ctx, record); err != nil {
+		log.Printf("Failed to record download of %s: %v", record.ObjectKey, err)
+	}
+}
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"gorm.io/gorm"
+	"prodhub-backend/config"
+	"prodhub-backend/helpers"
+	"prodhub-backend/models/mongo"
+	"prodhub-backend/models/postgres"
+)
+
+type ForkInput struct {
+	Name string `json:"name" binding:"omitempty,min=1,max=100"`
+}
+
+// Fork a public Repository into the current user's account. Branches and versions
+// are copied, but the new versions point at the same stored objects as the source.
+// Maintainers may also fork a private repository.
+func ForkRepo(c *gin.Context) {
+	ctx := context.Background()
+	userID, _ := c.Get("userID")
+	source := c.MustGet("repo").(mongo.Repo)
+
+	var input ForkInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			sendErrorResponse(c, http.StatusBadRequest, ErrInvalidInput)
+			return
+		}
+	}
+	if input.Name == "" {
+		input.Name = source.Name
+	}
+	if source.OwnerId == userID {
+		sendErrorResponse(c, http.StatusBadRequest, errors.New("cannot fork your own repository"))
+		return
+	}
+	// A fork makes its creator owner of a full copy, so private repos can
+	// only be forked by those who may already manage them
+	if !source.Public && c.MustGet("repoAccess").(helpers.Access) < helpers.AccessMaintain {
+		sendErrorResponse(c, http.StatusForbidden, errors.New("only public repositories can be forked"))
+		return
+	}
+
+	tx := config.PostgresDB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var user postgres.User
+	if err := tx.Where("user_id = ?", userID).First(&user).Error; err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		}
+		return
+	}
+
+	repoID, err := helpers.GetNextID(ctx, config.CounterCollection, "repoId")
+	if err != nil {
+		tx.Rollback()
+		sendErrorResponse(c, http.StatusInternalServerError, errors.New("failed to generate RepoID"))
+		return
+	}
+	forkID := fmt.Sprintf("%d", repoID)
+	now := time.Now().Unix()
+
+	branches := source.Branches
+	for i := range branches {
+		branches[i].Activities = []mongo.Activity{}
+	}
+	versions := source.Versions
+	if versions == nil {
+		versions = []mongo.Version{}
+	}
+
+	fork := mongo.Repo{
+		RepoID:        forkID,
+		OwnerId:       userID.(string),
+		Collaborators: []mongo.Collaborator{},
+		Invitations:   []mongo.Invitation{},
+		Name:          input.Name,
+		Description:   source.Description,
+		Activity: []mongo.Activity{
+			{
+				Date:        now,
+				Description: fmt.Sprintf("Forked from %s (#%s)", source.Name, source.RepoID),
+			},
+		},
+		Versions:  versions,
+		Branches:  branches,
+		Tags:      []mongo.Tag{},
+		Releases:  []mongo.Release{},
+		Reviews:   []mongo.ReviewRequest{},
+		Comments:  []mongo.VersionComment{},
+		CreatedAt: now,
+		UpdatedAt: now,
+		Public:    source.Public,
+		ForkedFrom: &mongo.ForkSource{
+			RepoID:   source.RepoID,
+			OwnerID:  source.OwnerId,
+			Name:     source.Name,
+			ForkedAt: now,
+		},
+		Forks: []string{},
+	}
+
+	// The fork shares every object of the source, so they are retained first
+	if err := retainObjects(ctx, forkID, repoObjectKeys(&fork)); err != nil {
+		log.Printf("Fork %s: %v", forkID, err)
+		tx.Rollback()
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+	if _, err := config.RepoCollection.InsertOne(ctx, fork); err != nil {
+		releaseObjects(ctx, forkID, nil)
+		tx.Rollback()
+		sendErrorResponse(c, http.StatusInternalServerError, errors.New("failed to create fork in MongoDB"))
+		return
+	}
+
+	// undo removes the fork again if a later step fails
+	undo := func() {
+		if _, err := config.RepoCollection.DeleteOne(ctx, bson.M{"repoId": forkID}); err != nil {
+			log.Printf("Failed to delete fork %s after failure: %v", forkID, err)
+		}
+		releaseObjects(ctx, forkID, nil)
+		revert := bson.M{"$inc": bson.M{"forkCount": -1}, "$pull": bson.M{"forks": forkID}}
+		if _, err := config.RepoCollection.UpdateOne(ctx, bson.M{"repoId": source.RepoID, "forks": forkID}, revert); err != nil {
+			log.Printf("Failed to revert fork count of repo %s: %v", source.RepoID, err)
+		}
+	}
+
+	sourceUpdate := bson.M{
+		"$inc":  bson.M{"forkCount": 1},
+		"$push": bson.M{"forks": forkID},
+	}
+	if _, err := config.RepoCollection.UpdateOne(ctx, bson.M{"repoId": source.RepoID}, sourceUpdate); err != nil {
+		undo()
+		tx.Rollback()
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+
+	user.RepoIDs = append(user.RepoIDs, forkID)
+	if err := tx.Save(&user).Error; err != nil {
+		undo()
+		tx.Rollback()
+		sendErrorResponse(c, http.StatusInternalServerError, errors.New("failed to update user data"))
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		undo()
+		sendErrorResponse(c, http.StatusInternalServerError, errors.New("failed to commit transaction"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, fork)
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"prodhub-backend/config"
+	"prodhub-backend/helpers"
+	"prodhub-backend/models/mongo"
+)
+
+// GraphNode is a version in the exported history graph
+type GraphNode struct {
+	VersionID string   `json:"id"`
+	ParentIDs []string `json:"parents"`
+	Branch    string   `json:"branch"`
+	Changes   string   `json:"changes"`
+	CreatedAt int64    `json:"createdAt"`
+}
+
+// GraphEdge links a parent version to a child version
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// GraphBranch is a branch label pointing at its head version
+type GraphBranch struct {
+	Name          string `json:"name"`
+	HeadVersionID string `json:"head"`
+	IsDefault     bool   `json:"isDefault"`
+}
+
+// GetVersionAncestry lists every ancestor of a version, nearest first
+func GetVersionAncestry(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repoID := c.Param("id")
+	versionID := c.Param("versionId")
+
+	var repo mongo.Repo
+	if err := config.RepoCollection.FindOne(ctx, bson.M{"repoId": repoID}).Decode(&repo); err != nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrRepoNotFound)
+		return
+	}
+
+	graph := helpers.NewVersionGraph(&repo)
+	version, ok := graph.Get(versionID)
+	if !ok {
+		sendErrorResponse(c, http.StatusNotFound, ErrVersionNotFound)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"version":   version,
+		"ancestors": graph.Ancestors(versionID),
+	})
+}
+
+// GetCommonAncestor finds the version two branches diverged from
+func GetCommonAncestor(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repoID := c.Param("id")
+	nameA := c.Query("a")
+	nameB := c.Query("b")
+	if nameA == "" || nameB == "" {
+		sendErrorResponse(c, http.StatusBadRequest, errors.New("both branch names a and b are required"))
+		return
+	}
+
+	var repo mongo.Repo
+	if err := config.RepoCollection.FindOne(ctx, bson.M{"repoId": repoID}).Decode(&repo); err != nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrRepoNotFound)
+		return
+	}
+
+	branchA := findBranch(&repo, nameA)
+	branchB := findBranch(&repo, nameB)
+	if branchA == nil || branchB == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrBranchNotFound)
+		return
+	}
+
+	response := gin.H{
+		"a":              gin.H{"branch": branchA.Name, "head": branchA.HeadVersionID},
+		"b":              gin.H{"branch": branchB.Name, "head": branchB.HeadVersionID},
+		"commonAncestor": nil,
+	}
+	graph := helpers.NewVersionGraph(&repo)
+	if ancestor, ok := graph.CommonAncestor(branchA.HeadVersionID, branchB.HeadVersionID); ok {
+		response["commonAncestor"] = ancestor
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetVersionGraph exports the version history as nodes and edges so it can be drawn as a tree
+func GetVersionGraph(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repoID := c.Param("id")
+
+	var repo mongo.Repo
+	if err := config.RepoCollection.FindOne(ctx, bson.M{"repoId": repoID}).Decode(&repo); err != nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrRepoNotFound)
+		return
+	}
+
+	graph := helpers.NewVersionGraph(&repo)
+	nodes := []GraphNode{}
+	edges := []GraphEdge{}
+	for _, v := range graph.Versions() {
+		parents := v.ParentIDs
+		if parents == nil {
+			parents = []string{}
+		}
+		nodes = append(nodes, GraphNode{
+			VersionID: v.VersionID,
+			ParentIDs: parents,
+			Branch:    v.Branch,
+			Changes:   v.Changes,
+			CreatedAt: v.CreatedAt,
+		})
+		for _, parentID := range parents {
+			if _, ok := graph.Get(parentID); ok {
+				edges = append(edges, GraphEdge{From: parentID, To: v.VersionID})
+			}
+		}
+	}
+
+	branches := []GraphBranch{}
+	for _, b := range repo.Branches {
+		branches = append(branches, GraphBranch{Name: b.Name, HeadVersionID: b.HeadVersionID, IsDefault: b.IsDefault})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"nodes": nodes, "edges": edges, "branches": branches})
+}
@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"prodhub-backend/config"
+	"prodhub-backend/helpers"
+	"prodhub-backend/models/mongo"
+)
+
+// Ways of picking the project file of a merge version
+const (
+	MergeTakeTheirs = "theirs" // use the source branch head
+	MergeTakeOurs   = "ours"   // keep the target branch head
+	MergeUpload     = "upload" // use a hand-merged file sent with the request
+)
+
+type MergeInput struct {
+	Source   string `form:"source" json:"source" binding:"required"`
+	Target   string `form:"target" json:"target" binding:"required"`
+	Strategy string `form:"strategy" json:"strategy" binding:"omitempty,oneof=theirs ours upload"`
+	Message  string `form:"message" json:"message"`
+}
+
+// mergePlan describes how a target branch changes when a source head is merged into it
+type mergePlan struct {
+	UpToDate    bool            // the source head is already part of the target
+	FastForward bool            // the target head is an ancestor of the source head
+	Versions    []mongo.Version // source versions the target is missing
+}
+
+// planMerge compares a target branch with a source head. sourceVersions are
+// the versions of the source branch, which graph must contain.
+func planMerge(graph *helpers.VersionGraph, target *mongo.Branch, sourceVersions []mongo.Version, sourceHead string) mergePlan {
+	if target.HeadVersionID != "" && graph.IsAncestor(sourceHead, target.HeadVersionID) {
+		return mergePlan{UpToDate: true}
+	}
+
+	onTarget := map[string]bool{}
+	for _, v := range target.Versions {
+		onTarget[v.VersionID] = true
+	}
+	versions := []mongo.Version{}
+	for _, v := range sourceVersions {
+		if !onTarget[v.VersionID] {
+			versions = append(versions, v)
+		}
+	}
+
+	return mergePlan{
+		FastForward: target.HeadVersionID == "" || graph.IsAncestor(target.HeadVersionID, sourceHead),
+		Versions:    versions,
+	}
+}
+
+// ErrBranchMoved is returned when a branch gets a new head while a merge or
+// upload onto it is prepared
+var ErrBranchMoved = errors.New("branch changed while it was being updated; try again")
+
+// applyMerge appends the merged versions to the target branch, moves its head
+// and logs the merge. It fails with ErrBranchMoved unless the target still has
+// the head the merge was planned against.
+func applyMerge(ctx context.Context, repo *mongo.Repo, target *mongo.Branch, versions []mongo.Version, head string, description string) error {
+	now := time.Now().Unix()
+	activity := mongo.Activity{Date: now, Description: description}
+
+	filter := branchHeadFilter(repo.RepoID, target)
+	update := bson.M{
+		"$set": bson.M{
+			"branches.$[t].headVersionId": head,
+			"updatedAt":                   now,
+		},
+		"$push": bson.M{
+			"branches.$[t].versions":   bson.M{"$each": versions},
+			"activity":                 activity,
+			"branches.$[t].activities": activity,
+		},
+	}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"t.name": target.Name}},
+	})
+
+	// Versions merged from a fork bring objects this repo did not use yet
+	keys := versionObjectKeys(versions)
+	if err := retainObjects(ctx, repo.RepoID, keys); err != nil {
+		return err
+	}
+	result, err := config.RepoCollection.UpdateOne(ctx, filter, update, opts)
+	if err == nil && result.MatchedCount == 0 {
+		err = ErrBranchMoved
+	}
+	if err != nil {
+		releaseObjects(ctx, repo.RepoID, unusedObjectKeys(repo, keys))
+		return err
+	}
+	return nil
+}
+
+// branchHeadFilter matches the repo only while branch still has the head it
+// was read with
+func branchHeadFilter(repoID string, branch *mongo.Branch) bson.M {
+	expectedHead := interface{}(branch.HeadVersionID)
+	if branch.HeadVersionID == "" {
+		expectedHead = bson.M{"$in": bson.A{"", nil}}
+	}
+	return bson.M{
+		"repoId":   repoID,
+		"branches": bson.M{"$elemMatch": bson.M{"name": branch.Name, "headVersionId": expectedHead}},
+	}
+}
+
+// sendMergeError reports an applyMerge failure
+func sendMergeError(c *gin.Context, err error) {
+	if errors.Is(err, ErrBranchMoved) {
+		sendErrorResponse(c, http.StatusConflict, err)
+		return
+	}
+	sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+}
+
+// MergeBranches brings the source branch into the target branch. A target that
+// has not moved since the branches diverged is fast-forwarded; otherwise a
+// merge version is created whose project file is picked by the strategy.
+func MergeBranches(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Second)
+	defer cancel()
+	repoID := c.Param("id")
+
+	var input MergeInput
+	if err := c.ShouldBind(&input); err != nil {
+		sendErrorResponse(c, http.StatusBadRequest, ErrInvalidInput)
+		return
+	}
+	if input.Source == input.Target {
+		sendErrorResponse(c, http.StatusBadRequest, errors.New("cannot merge a branch into itself"))
+		return
+	}
+
+	var repo mongo.Repo
+	if err := config.RepoCollection.FindOne(ctx, bson.M{"repoId": repoID}).Decode(&repo); err != nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrRepoNotFound)
+		return
+	}
+
+	source := findBranch(&repo, input.Source)
+	target := findBranch(&repo, input.Target)
+	if source == nil || target == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrBranchNotFound)
+		return
+	}
+	if source.HeadVersionID == "" {
+		sendErrorResponse(c, http.StatusBadRequest, errors.New("source branch has no versions to merge"))
+		return
+	}
+
+	graph := helpers.NewVersionGraph(&repo)
+	plan := planMerge(graph, target, source.Versions, source.HeadVersionID)
+	if plan.UpToDate {
+		c.JSON(http.StatusOK, gin.H{"message": "Target branch is already up to date", "head": target.HeadVersionID})
+		return
+	}
+
+	if plan.FastForward {
+		description := fmt.Sprintf("Fast-forwarded branch '%s' to '%s'", target.Name, source.Name)
+		if err := applyMerge(ctx, &repo, target, plan.Versions, source.HeadVersionID, description); err != nil {
+			sendMergeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"fastForward": true, "head": source.HeadVersionID})
+		return
+	}
+
+	mergeVersion, status, err := buildMergeVersion(c, graph, input, source.HeadVersionID, target.HeadVersionID)
+	if err != nil {
+		sendErrorResponse(c, status, err)
+		return
+	}
+	mergeVersion.Branch = target.Name
+	if mergeVersion.Changes == "" {
+		mergeVersion.Changes = fmt.Sprintf("Merge branch '%s' into '%s'", source.Name, target.Name)
+	}
+
+	versions := append(plan.Versions, *mergeVersion)
+	description := fmt.Sprintf("Merged branch '%s' into '%s' taking %s", source.Name, target.Name, input.Strategy)
+	if err := applyMerge(ctx, &repo, target, versions, mergeVersion.VersionID, description); err != nil {
+		sendMergeError(c, err)
+		return
+	}
+	if input.Strategy == MergeUpload {
+		queueAudioAnalysis(repoID, mergeVersion.Assets)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"fastForward": false, "head": mergeVersion.VersionID, "version": mergeVersion})
+}
+
+// buildMergeVersion creates the version recording a diverged merge. Its files
+// come from one of the two heads or from the uploaded asset form fields.
+func buildMergeVersion(c *gin.Context, graph *helpers.VersionGraph, input MergeInput, sourceHead, targetHead string) (*mongo.Version, int, error) {
+	version := &mongo.Version{
+		VersionID: uuid.New().String(),
+		Changes:   input.Message,
+		CreatedAt: time.Now().Unix(),
+		ParentIDs: []string{targetHead, sourceHead},
+	}
+
+	switch input.Strategy {
+	case MergeTakeTheirs, MergeTakeOurs:
+		winnerID := sourceHead
+		if input.Strategy == MergeTakeOurs {
+			winnerID = targetHead
+		}
+		winner, _ := graph.Get(winnerID)
+		version.ObjectKey = winner.ObjectKey
+		version.Project = winner.Project
+		version.Assets = winner.Assets
+		version.Loudness = winner.Loudness
+		version.Music = winner.Music
+	case MergeUpload:
+		form, err := c.MultipartForm()
+		if err != nil {
+			return nil, http.StatusBadRequest, errors.New("a merged file is required for the upload strategy")
+		}
+		files := collectAssetFiles(form)
+		if len(files) == 0 {
+			return nil, http.StatusBadRequest, errors.New("a merged file is required for the upload strategy")
+		}
+
+		for _, f := range files {
+			uploaded, err := uploadAsset(f, c.Param("id"))
+			if err != nil {
+				if errors.Is(err, ErrInvalidProject) {
+					return nil, http.StatusBadRequest, err
+				}
+				log.Printf("Upload failed: %v", err)
+				return nil, http.StatusInternalServerError, errors.New("failed to upload file")
+			}
+			if uploaded.Project != nil && version.Project == nil {
+				version.Project = uploaded.Project
+			}
+			version.Assets = append(version.Assets, uploaded.Asset)
+		}
+		primary := mainAsset(version.Assets)
+		version.ObjectKey = primary.ObjectKey
+	default:
+		return nil, http.StatusConflict, errors.New("branches have diverged; choose a strategy: theirs, ours or upload")
+	}
+
+	return version, http.StatusOK, nil
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"prodhub-backend/config"
+	"prodhub-backend/models/mongo"
+	"prodhub-backend/music"
+)
+
+// minDetectionConfidence is how sure detection must be before it contradicts
+// what the user typed
+const minDetectionConfidence = 0.5
+
+// detectedBPMTolerance is looser than bpmTolerance: audio tempo estimates
+// wobble more than the tempo stored in a project
+const detectedBPMTolerance = 2.0
+
+// bpmAgrees reports whether a detected tempo matches bpm, counting half and
+// double time as a match since detectors often land an octave off
+func bpmAgrees(detected float64, bpm int) bool {
+	for _, factor := range []float64{1, 2, 0.5} {
+		if math.Abs(detected*factor-float64(bpm)) <= detectedBPMTolerance {
+			return true
+		}
+	}
+	return false
+}
+
+// keyAgrees reports whether a detected key matches a scale typed by the user.
+// The relative key shares every note, so it counts as a match.
+func keyAgrees(detected, scale string) bool {
+	want, err := music.ParseKey(scale)
+	if err != nil {
+		return true // Nothing to check against
+	}
+	got, err := music.ParseKey(detected)
+	if err != nil {
+		return true
+	}
+	return got == want || got == want.Relative()
+}
+
+// flagMismatches sets the mismatch flags of a detection against a repo
+// description and returns a warning for each disagreement
+func flagMismatches(desc mongo.RepoDescription, detected *mongo.MusicAnalysis) []string {
+	warnings := []string{}
+	detected.BPMMismatch = desc.BPM != 0 && detected.BPMConfidence >= minDetectionConfidence &&
+		!bpmAgrees(detected.BPM, desc.BPM)
+	if detected.BPMMismatch {
+		warnings = append(warnings, fmt.Sprintf("audio sounds like %.1f BPM but the repository says %d BPM", detected.BPM, desc.BPM))
+	}
+	detected.KeyMismatch = desc.Scale != "" && detected.KeyConfidence >= minDetectionConfidence &&
+		!keyAgrees(detected.Key, desc.Scale)
+	if detected.KeyMismatch {
+		warnings = append(warnings, fmt.Sprintf("audio sounds like %s but the repository says %s", detected.Key, desc.Scale))
+	}
+	return warnings
+}
+
+// checkDetectedMusic flags where a detection disagrees with the repo
+// description and records it as the repo's latest detection. Only the mixdown
+// of the default branch's head is recorded, so an analysis of an older or
+// side-branch upload finishing late cannot replace it.
+func checkDetectedMusic(ctx context.Context, repoID string, detected *mongo.MusicAnalysis) error {
+	var repo mongo.Repo
+	if err := config.RepoCollection.FindOne(ctx, bson.M{"repoId": repoID}).Decode(&repo); err != nil {
+		return err
+	}
+	flagMismatches(repo.Description, detected)
+
+	head := defaultHead(&repo)
+	if head == nil || findAsset(head, detected.AssetID) == nil {
+		return nil
+	}
+	filter := bson.M{
+		"repoId":   repoID,
+		"branches": bson.M{"$elemMatch": bson.M{"isDefault": true, "headVersionId": head.VersionID}},
+	}
+	update := bson.M{"$set": bson.M{"description.detected": detected}}
+	_, err := config.RepoCollection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// defaultHead returns the head version of the default branch, or nil before
+// anything was uploaded to it
+func defaultHead(repo *mongo.Repo) *mongo.Version {
+	for i := range repo.Branches {
+		if repo.Branches[i].IsDefault {
+			return findVersion(repo, repo.Branches[i].HeadVersionID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"prodhub-backend/config"
+	"prodhub-backend/models/mongo"
+	"prodhub-backend/storage"
+)
+
+// contentPrefix holds every object stored under the hash of its contents
+const contentPrefix = "objects/sha256/"
+
+func contentKey(checksum string) string {
+	return contentPrefix + checksum
+}
+
+// storedContent is the outcome of storing a file
+type storedContent struct {
+	ObjectKey string
+	Size      int64
+	Checksum  string   // Hex SHA-256 of the contents
+	Reused    bool     // Identical contents were already stored, nothing was written
+	Repos     []string // Repos that already used the contents when they were reused
+}
+
+// storeContent stores r under the hash of its contents. The file is hashed
+// first, so contents already in the store are never written a second time.
+func storeContent(ctx context.Context, r io.ReadSeeker, fileName string) (storedContent, error) {
+	if config.Storage == nil {
+		return storedContent{}, fmt.Errorf("storage bucket is not initialized")
+	}
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, r)
+	if err != nil {
+		return storedContent{}, err
+	}
+	content := storedContent{Size: size, Checksum: hex.EncodeToString(hasher.Sum(nil))}
+	content.ObjectKey = contentKey(content.Checksum)
+
+	if object, err := claimStoredObject(ctx, content.Checksum, size, ""); err == nil {
+		content.Reused = true
+		content.Repos = object.Repos
+		return content, nil
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return storedContent{}, err
+	}
+	// Hash again while writing, so the stored bytes are the ones that were hashed
+	verify := sha256.New()
+	written, err := config.Storage.Put(ctx, content.ObjectKey, io.TeeReader(r, verify), contentTypeFor(fileName))
+	if err != nil {
+		return storedContent{}, err
+	}
+	if written != size || hex.EncodeToString(verify.Sum(nil)) != content.Checksum {
+		discardObject(content.ObjectKey)
+		return storedContent{}, errors.New("file changed while it was being stored")
+	}
+
+	if err := recordStoredObject(ctx, content, contentTypeFor(fileName)); err != nil {
+		return storedContent{}, err
+	}
+	return content, nil
+}
+
+// claimStoredObject looks up stored contents by hash and size for reuse. The
+// lookup restarts the grace period of the record in the same step, so garbage
+// collection either sees the claim and keeps the object, or has already
+// dropped the record and the contents are not offered for reuse.
+//
+// A non-empty repoID only finds contents that repo already uses. Checksums a
+// client declares are not proof that it has the bytes, so they may only stand
+// in for contents the repo references anyway.
+func claimStoredObject(ctx context.Context, checksum string, size int64, repoID string) (*mongo.StoredObject, error) {
+	var object mongo.StoredObject
+	filter := bson.M{"checksum": checksum, "size": size}
+	if repoID != "" {
+		filter["repos"] = repoID
+	}
+	update := bson.M{"$set": bson.M{"releasedAt": time.Now().Unix()}}
+	if err := config.ObjectCollection.FindOneAndUpdate(ctx, filter, update).Decode(&object); err != nil {
+		return nil, err
+	}
+	if _, err := config.Storage.Stat(ctx, object.ObjectKey); err != nil {
+		return nil, err
+	}
+	return &object, nil
+}
+
+// recordStoredObject registers newly written contents. Nothing references
+// them until a version is committed.
+func recordStoredObject(ctx context.Context, content storedContent, contentType string) error {
+	now := time.Now().Unix()
+	update := bson.M{"$setOnInsert": mongo.StoredObject{
+		Checksum:    content.Checksum,
+		ObjectKey:   content.ObjectKey,
+		Size:        content.Size,
+		ContentType: contentType,
+		Repos:       []string{},
+		Refs:        0,
+		CreatedAt:   now,
+		ReleasedAt:  now,
+	}}
+	opts := options.Update().SetUpsert(true)
+	_, err := config.ObjectCollection.UpdateOne(ctx, bson.M{"checksum": content.Checksum}, update, opts)
+	return err
+}
+
+// retainObjects records that repoID uses the stored objects among keys. It
+// runs before the write that makes the repo use them, so no repo references
+// an object that is not retained; when it fails the request must fail too.
+//
+// A record keeps the set of repos using the object rather than a count per
+// version. Adding or removing a repo is idempotent, so retried requests and
+// identical files in many versions cannot skew it, and refs, the size of the
+// set, is zero exactly when no repo uses the object anywhere. Which versions
+// of a repo use an object is read from the repo when it lets go of one, see
+// unusedObjectKeys.
+func retainObjects(ctx context.Context, repoID string, keys []string) error {
+	keys = contentKeys(keys)
+	if len(keys) == 0 {
+		return nil
+	}
+	pipeline := bson.A{
+		bson.M{"$set": bson.M{"repos": bson.M{"$setUnion": bson.A{"$repos", bson.A{repoID}}}}},
+		bson.M{"$set": bson.M{"refs": bson.M{"$size": "$repos"}}},
+	}
+	filter := bson.M{"objectKey": bson.M{"$in": keys}}
+	if _, err := config.ObjectCollection.UpdateMany(ctx, filter, pipeline); err != nil {
+		return fmt.Errorf("failed to add references of repo %s: %v", repoID, err)
+	}
+	return nil
+}
+
+// releaseObjects records that repoID no longer uses the stored objects among
+// keys, or any stored object when keys is nil. It runs after the repo stopped
+// using them. A failure only keeps the objects stored longer than needed, so
+// it is logged.
+func releaseObjects(ctx context.Context, repoID string, keys []string) {
+	filter := bson.M{"repos": repoID}
+	if keys != nil {
+		keys = contentKeys(keys)
+		if len(keys) == 0 {
+			return
+		}
+		filter["objectKey"] = bson.M{"$in": keys}
+	}
+	pipeline := bson.A{
+		bson.M{"$set": bson.M{"repos": bson.M{"$setDifference": bson.A{"$repos", bson.A{repoID}}}}},
+		bson.M{"$set": bson.M{"refs": bson.M{"$size": "$repos"}, "releasedAt": time.Now().Unix()}},
+	}
+	if _, err := config.ObjectCollection.UpdateMany(ctx, filter, pipeline); err != nil {
+		log.Printf("Failed to drop references of repo %s: %v", repoID, err)
+	}
+}
+
+// contentKeys keeps the distinct content-addressed keys. Older objects live
+// under per-upload keys and are not reference counted.
+func contentKeys(keys []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, key := range keys {
+		if strings.HasPrefix(key, contentPrefix) && !seen[key] {
+			seen[key] = true
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
+// versionObjectKeys lists the objects the versions use
+func versionObjectKeys(versions []mongo.Version) []string {
+	keys := []string{}
+	for _, v := range versions {
+		if v.ObjectKey != "" {
+			keys = append(keys, v.ObjectKey)
+		}
+		for _, asset := range v.Assets {
+			keys = append(keys, asset.ObjectKey)
+		}
+	}
+	return keys
+}
+
+// repoObjectKeys lists the objects a repo uses in any version or release
+func repoObjectKeys(repo *mongo.Repo) []string {
+	keys := versionObjectKeys(repo.Versions)
+	for _, branch := range repo.Branches {
+		keys = append(keys, versionObjectKeys(branch.Versions)...)
+	}
+	for _, release := range repo.Releases {
+		for _, asset := range release.Assets {
+			keys = append(keys, asset.ObjectKey)
+		}
+	}
+	return keys
+}
+
+// unusedObjectKeys keeps the keys repo no longer uses anywhere
+func unusedObjectKeys(repo *mongo.Repo, keys []string) []string {
+	used := map[string]bool{}
+	for _, key := range repoObjectKeys(repo) {
+		used[key] = true
+	}
+	unused := []string{}
+	for _, key := range keys {
+		if !used[key] {
+			unused = append(unused, key)
+		}
+	}
+	return unused
+}
+
+// discardObject deletes an object that is no longer referenced. Failures
+// only leave garbage behind, so they are logged.
+func discardObject(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := config.Storage.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotExist) {
+		log.Printf("Failed to delete object %s: %v", key, err)
+	}
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"prodhub-backend/flp"
+	"go.mongodb.org/mongo-driver/bson"
+	"prodhub-backend/models/mongo"
+)
+
+// ErrInvalidProject is returned for project files that cannot be parsed
+var ErrInvalidProject = errors.New("failed to read project file")
+
+// isProjectFile reports whether fileName is an FL Studio project
+func isProjectFile(fileName string) bool {
+	return strings.EqualFold(filepath.Ext(fileName), ".flp")
+}
+
+// contentTypeFor returns the content type uploads of fileName are stored with
+func contentTypeFor(fileName string) string {
+	if isProjectFile(fileName) {
+		return "application/x-flp"
+	}
+	if contentType, ok := audioContentTypes[strings.ToLower(filepath.Ext(fileName))]; ok {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// audioContentTypes maps audio file extensions to the type they are served with
+var audioContentTypes = map[string]string{
+	".wav":  "audio/wav",
+	".wave": "audio/wav",
+	".flac": "audio/flac",
+	".mp3":  "audio/mpeg",
+	".ogg":  "audio/ogg",
+	".aif":  "audio/aiff",
+	".aiff": "audio/aiff",
+	".mid":  "audio/midi",
+	".midi": "audio/midi",
+}
+
+// readProjectInfo parses an FL Studio project and rewinds file so it can be
+// uploaded afterwards
+func readProjectInfo(file io.ReadSeeker) (*mongo.ProjectInfo, error) {
+	project, err := flp.Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProject, err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return projectInfoFrom(project), nil
+}
+
+func projectInfoFrom(p *flp.Project) *mongo.ProjectInfo {
+	info := &mongo.ProjectInfo{
+		FLVersion:    p.FLVersion,
+		Tempo:        p.Tempo,
+		TimeSigNum:   p.TimeSigNum,
+		TimeSigBeat:  p.TimeSigBeat,
+		Channels:     make([]mongo.ProjectChannel, 0, len(p.Channels)),
+		Plugins:      p.Plugins,
+		PatternCount: p.PatternCount,
+		Samples:      p.Samples,
+	}
+	for _, ch := range p.Channels {
+		info.Channels = append(info.Channels, mongo.ProjectChannel{
+			Index:      ch.Index,
+			Name:       ch.Name,
+			Type:       ch.Type,
+			Plugin:     ch.Plugin,
+			SamplePath: ch.SamplePath,
+		})
+	}
+	return info
+}
+
+// bpmTolerance is how far the project tempo may be from the repo BPM before a
+// warning is raised. Projects often run at fractional tempos like 139.98.
+const bpmTolerance = 1.0
+
+// reconcileBPM compares the tempo of an uploaded project with the repo BPM.
+// It returns the description fields to update when the repo BPM is a
+// placeholder (never set, or itself taken from an earlier project), and a
+// warning when a user-entered BPM disagrees with the project.
+func reconcileBPM(desc mongo.RepoDescription, tempo float64) (bson.M, string) {
+	if tempo <= 0 {
+		return nil, ""
+	}
+	projectBPM := int(math.Round(tempo))
+
+	if desc.BPM == 0 || desc.BPMFromProject {
+		if desc.BPM == projectBPM && desc.BPMFromProject {
+			return nil, ""
+		}
+		return bson.M{
+			"description.bpm":            projectBPM,
+			"description.bpmFromProject": true,
+		}, ""
+	}
+
+	if math.Abs(tempo-float64(desc.BPM)) > bpmTolerance {
+		return nil, fmt.Sprintf("project tempo is %.2f BPM but the repository says %d BPM", tempo, desc.BPM)
+	}
+	return nil, ""
+}
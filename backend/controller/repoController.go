@@ -2,12 +2,17 @@ package controllers
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"prodhub-backend/config"
 	"prodhub-backend/models/mongo"
 	"prodhub-backend/models/postgres"
+	"prodhub-backend/music"
+	"strconv"
+	"strings"
 	"time"
 	"log"
     
@@ -15,6 +20,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"gorm.io/gorm"
 	"prodhub-backend/helpers"
 )
@@ -23,7 +29,7 @@ import (
 type RepoInput struct {
 	// OwnerID     string `json:"owner_id" binding:"required"`
 	Name   string `json:"name" binding:"required,min=1,max=100"`
-	BPM    int    `json:"bpm" binding:"required,min=20,max=300"`
+	BPM    int    `json:"bpm" binding:"omitempty,min=20,max=300"` // Left out to take the tempo of the first uploaded project
 	Scale  string `json:"scale" binding:"required"`
 	Genre  string `json:"genre" binding:"required"`
 	Public bool   `json:"public" default:"true"`
@@ -111,17 +117,14 @@ func CreateRepo(c *gin.Context) {
 	repo := mongo.Repo{
 		RepoID:        fmt.Sprintf("%d", repoID), // Use numeric RepoID as string
 		OwnerId:       userID.(string),          // Automatically set OwnerID from context
-		Collaborators: []string{},
+		Collaborators: []mongo.Collaborator{},
+		Invitations:   []mongo.Invitation{},
 		Name:          input.Name,
-		Description: struct {
-			BPM   int    `bson:"bpm"`
-			Scale string `bson:"scale"`
-			Genre string `bson:"genre"`
-		}{
-			BPM:   input.BPM,
-			Scale: input.Scale,
-			Genre: input.Genre,
-			
+		Description: mongo.RepoDescription{
+			BPM:     input.BPM,
+			Scale:   input.Scale,
+			Camelot: music.CamelotOf(input.Scale),
+			Genre:   input.Genre,
 		},
 		Activity: []mongo.Activity{
 			{
@@ -137,8 +140,14 @@ func CreateRepo(c *gin.Context) {
 				CreatedAt:  now,
 				Versions:   []mongo.Version{},
 				Activities: []mongo.Activity{},
+				IsDefault:  true,
 			},
 		},
+		Tags:      []mongo.Tag{},
+		Releases:  []mongo.Release{},
+		Reviews:   []mongo.ReviewRequest{},
+		Comments:  []mongo.VersionComment{},
+		Forks:     []string{},
 		CreatedAt: now,
 		UpdatedAt: now,
 		Public:    input.Public,
@@ -198,9 +207,11 @@ func UpdateRepo(c *gin.Context) {
 	}
 	if input.BPM != nil {
 		updateData["description.bpm"] = *input.BPM
+		updateData["description.bpmFromProject"] = false
 	}
 	if input.Scale != nil {
 		updateData["description.scale"] = *input.Scale
+		updateData["description.camelot"] = music.CamelotOf(*input.Scale)
 	}
 	if input.Genre != nil {
 		updateData["description.genre"] = *input.Genre
@@ -210,6 +221,21 @@ func UpdateRepo(c *gin.Context) {
 		updateData["public"] = input.Public
 	}
 
+	// Re-check the detected tempo and key against the new description
+	warnings := []string{}
+	if detected := repo.Description.Detected; detected != nil && (input.BPM != nil || input.Scale != nil) {
+		desc := repo.Description
+		if input.BPM != nil {
+			desc.BPM = *input.BPM
+		}
+		if input.Scale != nil {
+			desc.Scale = *input.Scale
+		}
+		checked := *detected
+		warnings = flagMismatches(desc, &checked)
+		updateData["description.detected"] = checked
+	}
+
 	
 
 	filter := bson.M{"repoId": repoID}
@@ -219,55 +245,155 @@ func UpdateRepo(c *gin.Context) {
 		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Repository updated successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Repository updated successfully", "warnings": warnings})
 }
 
 
+// Add a Version to a Branch
 func AddVersion(c *gin.Context) {
-	repoId := c.Param("repoId")
+	repoId := c.Param("id")
+	branchName := c.Param("branchName")
 
-	file,header,err := c.Request.FormFile("file")
+	form, err := c.MultipartForm()
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "File not found"})
 		return
 	}
-	defer file.Close()
+	files := collectAssetFiles(form)
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File not found"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	//UPLOAD FILE TO FIREBASE STORAGE
+	var repo mongo.Repo
+	if err := config.RepoCollection.FindOne(ctx, bson.M{"repoId": repoId}).Decode(&repo); err != nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrRepoNotFound)
+		return
+	}
+	branch := findBranch(&repo, branchName)
+	if branch == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrBranchNotFound)
+		return
+	}
 
-	fileURL, err := UploadFileUtil(file, header.Filename)
-if err != nil {
-    log.Printf("Upload failed: %v", err)
-    c.JSON(http.StatusInternalServerError, gin.H{
-        "error": "Failed to upload file",
-        "details": err.Error(),
-    })
-    return
+	//UPLOAD EVERY ASSET TO OBJECT STORAGE, READING PROJECT METADATA ON THE WAY
+	var project *mongo.ProjectInfo
+	var saved int64
+	assets := make([]mongo.Asset, 0, len(files))
+	for _, f := range files {
+		uploaded, err := uploadAsset(f, repo.RepoID)
+		if err != nil {
+			log.Printf("Upload failed: %v", err)
+			if errors.Is(err, ErrInvalidProject) {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":   "Failed to upload file",
+					"details": err.Error(),
+				})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload file"})
+			return
+		}
+		if uploaded.Project != nil && project == nil {
+			project = uploaded.Project
+		}
+		assets = append(assets, uploaded.Asset)
+		saved += uploaded.Saved
+	}
+
+	version, warnings, err := commitVersion(&repo, branch, c.PostForm("changes"), assets, project)
+	if errors.Is(err, ErrBranchMoved) {
+		sendErrorResponse(c, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to add version: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add version"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"version": version, "warnings": warnings, "bytesSaved": saved})
 }
 
+// commitVersion records uploaded assets as the new head of a branch and
+// queues their audio analysis. It returns the version with any warnings
+// about the repository description, or ErrBranchMoved when the branch got a
+// new head since it was read.
+func commitVersion(repo *mongo.Repo, branch *mongo.Branch, changes string, assets []mongo.Asset, project *mongo.ProjectInfo) (*mongo.Version, []string, error) {
+	primary := mainAsset(assets)
+	names := make([]string, 0, len(assets))
+	for _, asset := range assets {
+		names = append(names, asset.Name)
+	}
+
 	//Create version metadata
 	version := mongo.Version{
 		VersionID: uuid.New().String(),
-		URL:	   fileURL,
-		Changes:  c.PostForm("changes"),
+		ObjectKey: primary.ObjectKey,
+		Changes:   changes,
 		CreatedAt: time.Now().Unix(),
+		Project:   project,
+		ParentIDs: []string{},
+		Branch:    branch.Name,
+		Assets:    assets,
+	}
+	if branch.HeadVersionID != "" {
+		version.ParentIDs = append(version.ParentIDs, branch.HeadVersionID)
 	}
 
-	ctx,cancel :=context.WithTimeout(context.Background(),10*time.Second)
-	defer cancel()
-
-	filter := bson.M{"repoId": repoId}
-	update := bson.M{"$push": bson.M{"versions": version}}
-
-	_,err= config.RepoCollection.UpdateOne(ctx,filter,update)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add version"})
-		return
+	//CHECK THE REPO BPM AGAINST THE PROJECT TEMPO
+	warnings := []string{}
+	setData := bson.M{
+		"updatedAt":                   version.CreatedAt,
+		"branches.$[b].headVersionId": version.VersionID,
+	}
+	if project != nil {
+		descUpdate, warning := reconcileBPM(repo.Description, project.Tempo)
+		for field, value := range descUpdate {
+			setData[field] = value
+		}
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
 	}
 
-	c.JSON(http.StatusOK,version)
+	// The head read above becomes the parent, so it must not have moved
+	filter := branchHeadFilter(repo.RepoID, branch)
+	update := bson.M{
+		"$push": bson.M{
+			"branches.$[b].versions": version,
+			"branches.$[b].activities": mongo.Activity{
+				Date:        version.CreatedAt,
+				Description: "Version uploaded: " + strings.Join(names, ", "),
+			},
+		},
+		"$set": setData,
+	}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"b.name": branch.Name}},
+	})
 
+	// Uploads may have outlived any earlier deadline, so this gets its own
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
+	keys := versionObjectKeys([]mongo.Version{version})
+	if err := retainObjects(ctx, repo.RepoID, keys); err != nil {
+		return nil, nil, err
+	}
+	result, err := config.RepoCollection.UpdateOne(ctx, filter, update, opts)
+	if err == nil && result.MatchedCount == 0 {
+		err = ErrBranchMoved
+	}
+	if err != nil {
+		releaseObjects(ctx, repo.RepoID, unusedObjectKeys(repo, keys))
+		return nil, nil, err
+	}
+	queueAudioAnalysis(repo.RepoID, version.Assets)
+	return &version, warnings, nil
 }
 
 func AddActivity(c *gin.Context) {
@@ -295,8 +421,6 @@ func AddActivity(c *gin.Context) {
 func GetRepo(c *gin.Context) {
     ctx := context.Background()
     repoID := c.Param("id")
-	// I AM FETCHING USER_ID FROM THE CONTEXT
-	// userID, _ := c.Get("userID")
 
     var repo mongo.Repo
     if err := config.RepoCollection.FindOne(ctx, bson.M{"repoId": repoID}).Decode(&repo); err != nil {
@@ -304,13 +428,22 @@ func GetRepo(c *gin.Context) {
         return
     }
 
-	// THIS IS FOR SAFETY SO USERS CAN'T ACCESS PRIVATE REPOS
-	// if !repo.Public && repo.OwnerId != userID || !(helpers.Contains(repo.Collaborators,userID.(string))) {
-	// 	c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-	// }
+	// Private repos are hidden by the access middleware on the route
+	redactRepo(&repo, c.MustGet("repoAccess").(helpers.Access))
     c.JSON(http.StatusOK, repo)
 }
 
+// redactRepo removes what a caller with access may not see from a repo
+// document: unpublished releases, and invitations and a pending transfer
+// unless the caller maintains the repo
+func redactRepo(repo *mongo.Repo, access helpers.Access) {
+	repo.Releases = publishedReleases(repo.Releases)
+	if access < helpers.AccessMaintain {
+		repo.Invitations = []mongo.Invitation{}
+		repo.Transfer = nil
+	}
+}
+
 // Delete Repository
 func DeleteRepo(c *gin.Context) {
 	ctx := context.Background()
@@ -321,18 +454,16 @@ func DeleteRepo(c *gin.Context) {
         c.JSON(http.StatusNotFound, gin.H{"error": "Repo not found"})
         return
     }
-	// if repo.OwnerId != userID {
-	// 	c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can delete this repo"})
-	// 	return
-	// }
+	// Only the owner reaches this point, see RequireRepoAccess on the route
 
 	if _, err := config.RepoCollection.DeleteOne(ctx, bson.M{"repoId": repoID}); err != nil {
 		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
 		return
 	}
+	releaseObjects(ctx, repoID, nil)
 
 	var user postgres.User
-	if err := config.PostgresDB.First(&user, "id = ?", repo.OwnerId).Error; err != nil {
+	if err := config.PostgresDB.First(&user, "user_id = ?", repo.OwnerId).Error; err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Repository deleted successfully, but failed to update user data",
 		})
@@ -370,7 +501,7 @@ func GetRepoVersions(c *gin.Context) {
         c.JSON(http.StatusNotFound, gin.H{"error": "Repo not found"})
         return
     }
-	if !repo.Public && repo.OwnerId != userID && !(helpers.Contains(repo.Collaborators, userID.(string))) {
+	if helpers.RepoAccess(&repo, userID.(string)) < helpers.AccessRead {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
 		return
 	}
@@ -378,27 +509,170 @@ func GetRepoVersions(c *gin.Context) {
     c.JSON(http.StatusOK, repo.Versions)
 }
 
-func GetAllPublicRepos(c *gin.Context){
+// Listing defaults
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
 
-	ctx,cancel := context.WithTimeout(context.Background(),10*time.Second)
+// listSorts maps the sort query parameter to the field it orders by, descending
+var listSorts = map[string]string{
+	"newest":  "createdAt",
+	"updated": "updatedAt",
+	"likes":   "likes",
+}
+
+// summaryProjection loads only the fields of a RepoSummary
+var summaryProjection = bson.M{
+	"repoId":        1,
+	"ownerId":       1,
+	"collaborators": 1,
+	"name":          1,
+	"description":   1,
+	"createdAt":     1,
+	"updatedAt":     1,
+	"public":        1,
+	"forkedFrom":    1,
+	"forkCount":     1,
+	"likes":         1,
+}
+
+// listCursor marks where a page ended: the sort value and repo ID of its last repo
+type listCursor struct {
+	Value  int64  `json:"v"`
+	RepoID string `json:"id"`
+}
+
+// GetAllPublicRepos lists public repositories a page at a time. Query
+// parameters: genre, scale, owner, bpmMin, bpmMax, updatedSince (unix
+// seconds), sort (newest, updated or likes), limit and cursor, taken from
+// the nextCursor of the previous page.
+func GetAllPublicRepos(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	filter :=bson.M{"public" : true}
-	cursor,err := config.RepoCollection.Find(ctx,filter)
-	if err!=nil{
-		c.JSON(http.StatusInternalServerError,gin.H{"error":"Failed to fetch repos"})
+	sortBy := c.DefaultQuery("sort", "newest")
+	sortField, ok := listSorts[sortBy]
+	if !ok {
+		sendErrorResponse(c, http.StatusBadRequest, errors.New("sort must be newest, updated or likes"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultListLimit)))
+	if err != nil || limit < 1 {
+		sendErrorResponse(c, http.StatusBadRequest, errors.New("limit must be a positive integer"))
+		return
+	}
+	limit = min(limit, maxListLimit)
+
+	filter, err := listFilter(c)
+	if err != nil {
+		sendErrorResponse(c, http.StatusBadRequest, err)
+		return
+	}
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := decodeListCursor(raw)
+		if err != nil {
+			sendErrorResponse(c, http.StatusBadRequest, errors.New("invalid cursor"))
+			return
+		}
+		// Continue after the last repo of the previous page, breaking ties
+		// between equal sort values by repo ID
+		filter = bson.M{"$and": bson.A{filter, bson.M{"$or": bson.A{
+			bson.M{sortField: bson.M{"$lt": cursor.Value}},
+			bson.M{sortField: cursor.Value, "repoId": bson.M{"$lt": cursor.RepoID}},
+		}}}}
+	}
+
+	opts := options.Find().
+		SetProjection(summaryProjection).
+		SetSort(bson.D{{Key: sortField, Value: -1}, {Key: "repoId", Value: -1}}).
+		SetLimit(int64(limit) + 1)
+	cursor, err := config.RepoCollection.Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch repos"})
 		return
 	}
 	defer cursor.Close(ctx)
 
-	var repos []mongo.Repo
-	if err := cursor.All(ctx,&repos); err != nil {
-		c.JSON(http.StatusInternalServerError,gin.H{"error":"Failed to decode repos"})
+	repos := []mongo.RepoSummary{}
+	if err := cursor.All(ctx, &repos); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode repos"})
 		return
 	}
 
-	c.JSON(http.StatusOK,repos)
+	// One repo more than asked for means there is another page
+	nextCursor := ""
+	if len(repos) > limit {
+		repos = repos[:limit]
+		last := repos[limit-1]
+		nextCursor = encodeListCursor(listCursor{Value: summarySortValue(last, sortField), RepoID: last.RepoID})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"repos": repos, "nextCursor": nextCursor})
+}
+
+// listFilter builds the query for the listing filters
+func listFilter(c *gin.Context) (bson.M, error) {
+	filter := bson.M{"public": true}
+	if genre := c.Query("genre"); genre != "" {
+		filter["description.genre"] = genre
+	}
+	if scale := c.Query("scale"); scale != "" {
+		filter["description.scale"] = scale
+	}
+	if owner := c.Query("owner"); owner != "" {
+		filter["ownerId"] = owner
+	}
+
+	bpm := bson.M{}
+	for param, op := range map[string]string{"bpmMin": "$gte", "bpmMax": "$lte"} {
+		if raw := c.Query(param); raw != "" {
+			value, err := strconv.Atoi(raw)
+			if err != nil || value < 0 {
+				return nil, fmt.Errorf("%s must be a positive integer", param)
+			}
+			bpm[op] = value
+		}
+	}
+	if len(bpm) > 0 {
+		filter["description.bpm"] = bpm
+	}
+
+	if raw := c.Query("updatedSince"); raw != "" {
+		since, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, errors.New("updatedSince must be a unix timestamp")
+		}
+		filter["updatedAt"] = bson.M{"$gte": since}
+	}
+	return filter, nil
 }
+
+func summarySortValue(repo mongo.RepoSummary, sortField string) int64 {
+	switch sortField {
+	case "updatedAt":
+		return repo.UpdatedAt
+	case "likes":
+		return int64(repo.Likes)
+	}
+	return repo.CreatedAt
+}
+
+func encodeListCursor(cursor listCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeListCursor(raw string) (listCursor, error) {
+	var cursor listCursor
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
+
 // Create a Branch
 func CreateBranch(c *gin.Context) {
 	ctx := context.Background()
@@ -437,6 +711,7 @@ func CreateBranch(c *gin.Context) {
 		for _, branch := range repo.Branches {
 			if branch.Name == input.SourceBranch {
 				newBranch.Versions = branch.Versions
+				newBranch.HeadVersionID = branch.HeadVersionID
 				newBranch.Activities = branch.Activities
 				sourceBranchFound = true
 				break
@@ -483,6 +758,48 @@ func GetBranch(c *gin.Context) {
 	sendErrorResponse(c, http.StatusNotFound, ErrBranchNotFound)
 }
 
+// Get the version history of a Branch, newest first
+func GetBranchVersions(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repoID := c.Param("id")
+	branchName := c.Param("branchName")
+
+	var repo mongo.Repo
+	if err := config.RepoCollection.FindOne(ctx, bson.M{"repoId": repoID}).Decode(&repo); err != nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrRepoNotFound)
+		return
+	}
+
+	branch := findBranch(&repo, branchName)
+	if branch == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrBranchNotFound)
+		return
+	}
+
+	history := make([]mongo.Version, 0, len(branch.Versions))
+	for i := len(branch.Versions) - 1; i >= 0; i-- {
+		history = append(history, branch.Versions[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"branch":        branch.Name,
+		"headVersionId": branch.HeadVersionID,
+		"versions":      history,
+		"loudness":      loudnessHistory(branch.Versions),
+	})
+}
+
+// findBranch returns the branch of repo called name, or nil
+func findBranch(repo *mongo.Repo, name string) *mongo.Branch {
+	for i := range repo.Branches {
+		if repo.Branches[i].Name == name {
+			return &repo.Branches[i]
+		}
+	}
+	return nil
+}
+
 // Switch Branch
 func SwitchBranch(c *gin.Context) {
 	ctx := context.Background()
@@ -511,11 +828,6 @@ func DeleteBranch(c *gin.Context) {
 	repoID := c.Param("id")
 	branchName := c.Param("branchName")
 
-	if branchName == "main" {
-		sendErrorResponse(c, http.StatusBadRequest, errors.New("cannot delete main branch"))
-		return
-	}
-
 	var repo mongo.Repo
 	if err := config.RepoCollection.FindOne(ctx, bson.M{"repoId": repoID}).Decode(&repo); err != nil {
 		sendErrorResponse(c, http.StatusNotFound, ErrRepoNotFound)
@@ -523,29 +835,60 @@ func DeleteBranch(c *gin.Context) {
 	}
 
 	// Check if branch exists
-	branchExists := false
+	deleted := findBranch(&repo, branchName)
+	if deleted == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrBranchNotFound)
+		return
+	}
+	if deleted.IsDefault {
+		sendErrorResponse(c, http.StatusBadRequest, errors.New("cannot delete the default branch"))
+		return
+	}
+
+	// Objects only the deleted branch used are no longer referenced
+	remaining := repo
+	remaining.Branches = nil
 	for _, branch := range repo.Branches {
-		if branch.Name == branchName {
-			branchExists = true
-			break
+		if branch.Name != branchName {
+			remaining.Branches = append(remaining.Branches, branch)
 		}
 	}
+	unused := unusedObjectKeys(&remaining, versionObjectKeys(deleted.Versions))
 
-	if !branchExists {
-		sendErrorResponse(c, http.StatusNotFound, ErrBranchNotFound)
-		return
+	// Tagged versions are immutable, so a branch that is the only one holding
+	// one cannot go. Releases point at tags and are covered by the same check.
+	onlyHere := []string{}
+	for _, version := range deleted.Versions {
+		if findVersion(&remaining, version.VersionID) == nil {
+			onlyHere = append(onlyHere, version.VersionID)
+		}
+	}
+	for _, tag := range repo.Tags {
+		for _, versionID := range onlyHere {
+			if tag.VersionID == versionID {
+				sendErrorResponse(c, http.StatusConflict, fmt.Errorf("branch holds the version tagged '%s'; delete the tag first", tag.Name))
+				return
+			}
+		}
 	}
 
-	filter := bson.M{"repoId": repoID}
+	// A tag created in the meantime stops the delete as well
+	filter := bson.M{"repoId": repoID, "tags.versionId": bson.M{"$nin": onlyHere}}
 	update := bson.M{
 		"$pull": bson.M{"branches": bson.M{"name": branchName}},
 		"$set":  bson.M{"updatedAt": time.Now().Unix()},
 	}
 
-	if _, err := config.RepoCollection.UpdateOne(ctx, filter, update); err != nil {
+	result, err := config.RepoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
 		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
 		return
 	}
+	if result.MatchedCount == 0 {
+		sendErrorResponse(c, http.StatusConflict, errors.New("branch holds a tagged version; delete the tag first"))
+		return
+	}
+	releaseObjects(ctx, repoID, unused)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Branch deleted successfully"})
 }
\ No newline at end of file
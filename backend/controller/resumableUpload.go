@@ -0,0 +1,727 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodriver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"prodhub-backend/config"
+	"prodhub-backend/flp"
+	"prodhub-backend/helpers"
+	"prodhub-backend/models/mongo"
+)
+
+// Resumable upload limits
+const (
+	maxChunkSize     = 64 << 20 // Bytes per chunk request
+	maxUploadFiles   = 200
+	maxUploadFile    = 20 << 30 // Bytes per file
+	uploadLifetime   = 24 * time.Hour
+	assemblyTimeout  = 30 * time.Minute
+	chunkChecksumKey = "X-Chunk-Checksum"
+)
+
+var ErrUploadNotFound = errors.New("upload not found")
+
+var sha256Hex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+type UploadFileInput struct {
+	Name     string `json:"name" binding:"required"`
+	Kind     string `json:"kind"`
+	Size     int64  `json:"size" binding:"required,min=1"`
+	Checksum string `json:"checksum"` // Hex SHA-256 of the whole file
+}
+
+type StartUploadInput struct {
+	Changes string            `json:"changes"`
+	Files   []UploadFileInput `json:"files" binding:"required,min=1,dive"`
+}
+
+// ByteRange is a half-open range of bytes, End excluded
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+// UploadFileStatus tells a client which bytes of a file are still missing
+type UploadFileStatus struct {
+	FileID   string
+	Name     string
+	Kind     string
+	Size     int64
+	Received int64
+	Missing  []ByteRange
+	Reused   bool // The repo already stores identical contents, no chunks are needed
+}
+
+// UploadStatus is the progress of a resumable upload
+type UploadStatus struct {
+	UploadID     string
+	Status       string
+	VersionID    string
+	ExpiresAt    int64
+	MaxChunkSize int64
+	BytesSaved   int64 // Bytes that need no upload because the repo already stores them
+	Files        []UploadFileStatus
+}
+
+// StartUpload opens a resumable upload of a version's files. Chunks are then
+// sent with UploadChunk and the version is created by CompleteUpload. Files
+// whose checksum matches contents the repo already uses need no chunks at
+// all; any other file is sent in full and hashed here before it is stored.
+func StartUpload(c *gin.Context) {
+	repo := c.MustGet("repo").(mongo.Repo)
+	userID, _ := c.Get("userID")
+	branchName := c.Param("branchName")
+
+	var input StartUploadInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		sendErrorResponse(c, http.StatusBadRequest, ErrInvalidInput)
+		return
+	}
+	if findBranch(&repo, branchName) == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrBranchNotFound)
+		return
+	}
+	if len(input.Files) > maxUploadFiles {
+		sendErrorResponse(c, http.StatusBadRequest, fmt.Errorf("at most %d files can be uploaded at once", maxUploadFiles))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	session := mongo.UploadSession{
+		UploadID:  uuid.New().String(),
+		RepoID:    repo.RepoID,
+		Branch:    branchName,
+		UserID:    userID.(string),
+		Changes:   input.Changes,
+		Files:     make([]mongo.UploadFile, 0, len(input.Files)),
+		Status:    mongo.UploadOpen,
+		CreatedAt: now.Unix(),
+		UpdatedAt: now.Unix(),
+		ExpiresAt: now.Add(uploadLifetime).Unix(),
+	}
+	for _, f := range input.Files {
+		name := path.Base(strings.ReplaceAll(f.Name, "\\", "/"))
+		if name == "." || name == "/" || name == ".." {
+			sendErrorResponse(c, http.StatusBadRequest, fmt.Errorf("invalid file name %q", f.Name))
+			return
+		}
+		if f.Size > maxUploadFile {
+			sendErrorResponse(c, http.StatusBadRequest, fmt.Errorf("%s is larger than %d bytes", name, int64(maxUploadFile)))
+			return
+		}
+		checksum := strings.ToLower(f.Checksum)
+		if checksum != "" && !sha256Hex.MatchString(checksum) {
+			sendErrorResponse(c, http.StatusBadRequest, fmt.Errorf("checksum of %s is not a hex SHA-256", name))
+			return
+		}
+		file := mongo.UploadFile{
+			FileID:   uuid.New().String(),
+			Name:     name,
+			Kind:     assetKindFor(f.Kind, name),
+			Size:     f.Size,
+			Checksum: checksum,
+			Parts:    []mongo.UploadPart{},
+		}
+		if checksum != "" {
+			if object, err := claimStoredObject(ctx, checksum, f.Size, repo.RepoID); err == nil {
+				file.ObjectKey = object.ObjectKey
+			}
+		}
+		session.Files = append(session.Files, file)
+	}
+
+	if _, err := config.UploadCollection.InsertOne(ctx, session); err != nil {
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+	c.JSON(http.StatusCreated, uploadStatus(&session))
+}
+
+// GetUpload reports which bytes of each file have arrived, so an interrupted
+// client knows where to resume
+func GetUpload(c *gin.Context) {
+	repo := c.MustGet("repo").(mongo.Repo)
+	session, err := loadUpload(c.Request.Context(), repo.RepoID, c.Param("uploadId"))
+	if err != nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrUploadNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, uploadStatus(session))
+}
+
+// UploadChunk stores one chunk of a file. The offset query parameter places
+// it in the file and an optional X-Chunk-Checksum header, the hex SHA-256 of
+// the chunk, is verified. Sending a chunk again at the same offset replaces it.
+func UploadChunk(c *gin.Context) {
+	repo := c.MustGet("repo").(mongo.Repo)
+	userID, _ := c.Get("userID")
+
+	offset, err := strconv.ParseInt(c.Query("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		sendErrorResponse(c, http.StatusBadRequest, errors.New("offset must be a non-negative integer"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	session, err := loadUpload(ctx, repo.RepoID, c.Param("uploadId"))
+	if err != nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrUploadNotFound)
+		return
+	}
+	if session.UserID != userID {
+		sendErrorResponse(c, http.StatusForbidden, errors.New("only the uploader can send chunks"))
+		return
+	}
+	if session.Status != mongo.UploadOpen {
+		sendErrorResponse(c, http.StatusConflict, errors.New("upload is no longer open"))
+		return
+	}
+	file := findUploadFile(session, c.Param("fileId"))
+	if file == nil {
+		sendErrorResponse(c, http.StatusNotFound, errors.New("file not found in upload"))
+		return
+	}
+	if file.ObjectKey != "" {
+		sendErrorResponse(c, http.StatusConflict, errors.New("file is already stored; no chunks are needed"))
+		return
+	}
+	if offset >= file.Size {
+		sendErrorResponse(c, http.StatusBadRequest, errors.New("offset is past the end of the file"))
+		return
+	}
+
+	// Each attempt gets its own object, so a failed retry never destroys a
+	// chunk that was already received
+	key := fmt.Sprintf("uploads/%s/%s/%d-%s", session.UploadID, file.FileID, offset, uuid.New().String())
+	hasher := sha256.New()
+	counter := &countingWriter{}
+	body := io.TeeReader(http.MaxBytesReader(c.Writer, c.Request.Body, maxChunkSize), io.MultiWriter(hasher, counter))
+	if _, err := config.Storage.Put(ctx, key, body, "application/octet-stream"); err != nil {
+		discardObject(key)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			sendErrorResponse(c, http.StatusRequestEntityTooLarge, fmt.Errorf("chunks are limited to %d bytes", maxChunkSize))
+			return
+		}
+		sendErrorResponse(c, http.StatusBadRequest, errors.New("chunk was not received completely"))
+		return
+	}
+
+	part := mongo.UploadPart{
+		Offset:    offset,
+		Size:      counter.n,
+		End:       offset + counter.n,
+		ObjectKey: key,
+		Checksum:  hex.EncodeToString(hasher.Sum(nil)),
+	}
+	if status, err := checkChunk(file, part, c.GetHeader(chunkChecksumKey)); err != nil {
+		discardObject(key)
+		sendErrorResponse(c, status, err)
+		return
+	}
+
+	replaced, err := recordChunk(session, file, part)
+	if err != nil {
+		discardObject(key)
+		status := http.StatusConflict
+		if errors.Is(err, ErrDatabaseOp) {
+			status = http.StatusInternalServerError
+		}
+		sendErrorResponse(c, status, err)
+		return
+	}
+	if replaced != nil {
+		discardObject(replaced.ObjectKey)
+	}
+
+	// Report progress as it stands with this chunk in place
+	parts := []mongo.UploadPart{part}
+	for _, p := range file.Parts {
+		if p.Offset != offset {
+			parts = append(parts, p)
+		}
+	}
+	file.Parts = parts
+	c.JSON(http.StatusOK, uploadFileStatus(file))
+}
+
+// checkChunk validates a received chunk against its file and checksum header
+func checkChunk(file *mongo.UploadFile, part mongo.UploadPart, wantChecksum string) (int, error) {
+	if part.Size == 0 {
+		return http.StatusBadRequest, errors.New("chunk is empty")
+	}
+	if wantChecksum != "" && !strings.EqualFold(wantChecksum, part.Checksum) {
+		return http.StatusUnprocessableEntity, errors.New("chunk does not match its checksum; send it again")
+	}
+	if part.Offset+part.Size > file.Size {
+		return http.StatusBadRequest, errors.New("chunk runs past the end of the file")
+	}
+	for _, p := range file.Parts {
+		if p.Offset != part.Offset && part.Offset < p.Offset+p.Size && p.Offset < part.Offset+part.Size {
+			return http.StatusConflict, fmt.Errorf("chunk overlaps bytes %d-%d, which were already received", p.Offset, p.Offset+p.Size)
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// errChunkOverlap is returned when a chunk covers bytes another chunk already holds
+var errChunkOverlap = errors.New("chunk overlaps bytes which were already received")
+
+// recordChunk adds a part to its file, replacing a part at the same offset.
+// It returns the replaced part, whose object is no longer needed. Both the
+// choice between adding and replacing and the overlap check happen in the
+// update itself, so retried chunks racing each other cannot both be added.
+func recordChunk(session *mongo.UploadSession, file *mongo.UploadFile, part mongo.UploadPart) (*mongo.UploadPart, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	set := bson.M{"updatedAt": now.Unix(), "expiresAt": now.Add(uploadLifetime).Unix()}
+	fileFilter := bson.M{"f.fileId": file.FileID}
+	end := part.Offset + part.Size
+
+	// Add the chunk when no part overlaps it, including one at the same offset
+	free := bson.M{"$not": bson.M{"$elemMatch": bson.M{"offset": bson.M{"$lt": end}, "end": bson.M{"$gt": part.Offset}}}}
+	filter := bson.M{
+		"uploadId": session.UploadID,
+		"status":   mongo.UploadOpen,
+		"files":    bson.M{"$elemMatch": bson.M{"fileId": file.FileID, "parts": free}},
+	}
+	update := bson.M{"$set": set, "$push": bson.M{"files.$[f].parts": part}}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{fileFilter}})
+	result, err := config.UploadCollection.UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		return nil, ErrDatabaseOp
+	}
+	if result.MatchedCount == 1 {
+		return nil, nil
+	}
+
+	// Otherwise replace the part at the same offset, provided no other part overlaps
+	others := bson.M{"$not": bson.M{"$elemMatch": bson.M{
+		"offset": bson.M{"$lt": end, "$ne": part.Offset},
+		"end":    bson.M{"$gt": part.Offset},
+	}}}
+	filter["files"] = bson.M{"$elemMatch": bson.M{"fileId": file.FileID, "parts.offset": part.Offset, "parts": others}}
+	set["files.$[f].parts.$[p]"] = part
+	replaceOpts := options.FindOneAndUpdate().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{fileFilter, bson.M{"p.offset": part.Offset}},
+	})
+	var before mongo.UploadSession
+	err = config.UploadCollection.FindOneAndUpdate(ctx, filter, bson.M{"$set": set}, replaceOpts).Decode(&before)
+	if err == nil {
+		if old := findUploadFile(&before, file.FileID); old != nil {
+			for i := range old.Parts {
+				if old.Parts[i].Offset == part.Offset {
+					return &old.Parts[i], nil
+				}
+			}
+		}
+		return nil, nil
+	}
+	if !errors.Is(err, mongodriver.ErrNoDocuments) {
+		return nil, ErrDatabaseOp
+	}
+
+	current, err := loadUpload(ctx, session.RepoID, session.UploadID)
+	if err != nil || current.Status != mongo.UploadOpen {
+		return nil, errors.New("upload is no longer open")
+	}
+	return nil, errChunkOverlap
+}
+
+// CompleteUpload assembles every file once all of its chunks are in, checks
+// the whole files against their checksums and only then creates the version
+func CompleteUpload(c *gin.Context) {
+	repo := c.MustGet("repo").(mongo.Repo)
+	userID, _ := c.Get("userID")
+
+	session, err := loadUpload(c.Request.Context(), repo.RepoID, c.Param("uploadId"))
+	if err != nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrUploadNotFound)
+		return
+	}
+	if session.UserID != userID {
+		sendErrorResponse(c, http.StatusForbidden, errors.New("only the uploader can complete an upload"))
+		return
+	}
+	if session.Status != mongo.UploadOpen {
+		sendErrorResponse(c, http.StatusConflict, errors.New("upload is no longer open"))
+		return
+	}
+	for i := range session.Files {
+		if missing := missingRanges(&session.Files[i]); len(missing) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "some chunks are missing", "upload": uploadStatus(session)})
+			return
+		}
+	}
+
+	// Claim the upload so a second request cannot assemble it too
+	if err := setUploadStatus(session.UploadID, mongo.UploadOpen, bson.M{"status": mongo.UploadCompleting}); err != nil {
+		sendErrorResponse(c, http.StatusConflict, err)
+		return
+	}
+	reopen := func() {
+		if err := setUploadStatus(session.UploadID, mongo.UploadCompleting, bson.M{"status": mongo.UploadOpen}); err != nil {
+			log.Printf("Failed to reopen upload %s: %v", session.UploadID, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), assemblyTimeout)
+	defer cancel()
+
+	assets, project, saved, status, err := assembleUpload(ctx, session)
+	if err != nil {
+		reopen()
+		sendErrorResponse(c, status, err)
+		return
+	}
+
+	// Assembly can take a while; take the branch head as it is now
+	var current mongo.Repo
+	if err := config.RepoCollection.FindOne(ctx, bson.M{"repoId": repo.RepoID}).Decode(&current); err != nil {
+		reopen()
+		sendErrorResponse(c, http.StatusNotFound, ErrRepoNotFound)
+		return
+	}
+	branch := findBranch(&current, session.Branch)
+	if branch == nil {
+		reopen()
+		sendErrorResponse(c, http.StatusNotFound, ErrBranchNotFound)
+		return
+	}
+
+	version, warnings, err := commitVersion(&current, branch, session.Changes, assets, project)
+	if errors.Is(err, ErrBranchMoved) {
+		reopen()
+		sendErrorResponse(c, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to add version: %v", err)
+		reopen()
+		sendErrorResponse(c, http.StatusInternalServerError, errors.New("failed to add version"))
+		return
+	}
+
+	done := bson.M{"status": mongo.UploadCompleted, "versionId": version.VersionID}
+	if err := setUploadStatus(session.UploadID, mongo.UploadCompleting, done); err != nil {
+		log.Printf("Failed to close upload %s: %v", session.UploadID, err)
+	}
+	discardParts(session)
+
+	c.JSON(http.StatusOK, gin.H{"version": version, "warnings": warnings, "bytesSaved": saved})
+}
+
+// AbortUpload cancels an open upload and throws its chunks away. The
+// uploader and maintainers can abort.
+func AbortUpload(c *gin.Context) {
+	repo := c.MustGet("repo").(mongo.Repo)
+	access := c.MustGet("repoAccess").(helpers.Access)
+	userID, _ := c.Get("userID")
+
+	session, err := loadUpload(c.Request.Context(), repo.RepoID, c.Param("uploadId"))
+	if err != nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrUploadNotFound)
+		return
+	}
+	if session.UserID != userID && access < helpers.AccessMaintain {
+		sendErrorResponse(c, http.StatusForbidden, errors.New("Access denied"))
+		return
+	}
+	if err := setUploadStatus(session.UploadID, mongo.UploadOpen, bson.M{"status": mongo.UploadAborted}); err != nil {
+		sendErrorResponse(c, http.StatusConflict, err)
+		return
+	}
+	discardParts(session)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Upload aborted"})
+}
+
+// assembleUpload joins the chunks of every file into its final object,
+// checking each chunk and each whole file on the way. Contents stored before
+// a failure stay unreferenced and are left to garbage collection, since
+// identical files elsewhere may share them.
+func assembleUpload(ctx context.Context, session *mongo.UploadSession) ([]mongo.Asset, *mongo.ProjectInfo, int64, int, error) {
+	var project *mongo.ProjectInfo
+	var saved int64
+	assets := make([]mongo.Asset, 0, len(session.Files))
+	for i := range session.Files {
+		file := &session.Files[i]
+		content, status, err := assembleFile(ctx, session, file)
+		if err != nil {
+			return nil, nil, 0, status, fmt.Errorf("%s: %v", file.Name, err)
+		}
+		asset := newAsset(content, file.Name, file.Kind)
+		if asset.Kind == mongo.AssetProject && isProjectFile(asset.Name) {
+			info, err := readStoredProject(ctx, asset.ObjectKey)
+			if err != nil {
+				return nil, nil, 0, http.StatusUnprocessableEntity, fmt.Errorf("%s: %v", file.Name, err)
+			}
+			if project == nil {
+				project = info
+			}
+		}
+		assets = append(assets, asset)
+		saved += bytesSaved(content, session.RepoID)
+	}
+	return assets, project, saved, http.StatusOK, nil
+}
+
+// assembleFile stores the contents of one file, or finds them already stored
+func assembleFile(ctx context.Context, session *mongo.UploadSession, file *mongo.UploadFile) (storedContent, int, error) {
+	if file.ObjectKey != "" {
+		object, err := claimStoredObject(ctx, file.Checksum, file.Size, session.RepoID)
+		if err != nil {
+			// The repo dropped its copy since the upload started, so the
+			// file has to be sent after all
+			forgetStoredCopy(session.UploadID, file.FileID)
+			return storedContent{}, http.StatusConflict, errors.New("file is no longer stored; upload its chunks")
+		}
+		return storedContent{ObjectKey: object.ObjectKey, Size: file.Size, Checksum: file.Checksum, Reused: true, Repos: object.Repos}, http.StatusOK, nil
+	}
+
+	reader := &partsReader{ctx: ctx, parts: sortedParts(file)}
+	content, err := storeContent(ctx, reader, file.Name)
+	reader.Close()
+	if err != nil {
+		if errors.Is(err, errCorruptPart) {
+			return storedContent{}, http.StatusUnprocessableEntity, err
+		}
+		return storedContent{}, http.StatusInternalServerError, err
+	}
+
+	if content.Size != file.Size {
+		return storedContent{}, http.StatusUnprocessableEntity,
+			fmt.Errorf("assembled %d bytes but %d were announced", content.Size, file.Size)
+	}
+	if file.Checksum != "" && content.Checksum != file.Checksum {
+		return storedContent{}, http.StatusUnprocessableEntity, errors.New("assembled file does not match its checksum")
+	}
+	return content, http.StatusOK, nil
+}
+
+// readStoredProject parses the metadata of a stored project file
+func readStoredProject(ctx context.Context, objectKey string) (*mongo.ProjectInfo, error) {
+	reader, err := config.Storage.Get(ctx, objectKey)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	parsed, err := flp.Parse(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read project file: %v", err)
+	}
+	return projectInfoFrom(parsed), nil
+}
+
+// forgetStoredCopy makes a file that was going to reuse stored contents
+// expect chunks again
+func forgetStoredCopy(uploadID, fileID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	update := bson.M{"$unset": bson.M{"files.$[f].objectKey": ""}}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"f.fileId": fileID}}})
+	if _, err := config.UploadCollection.UpdateOne(ctx, bson.M{"uploadId": uploadID}, update, opts); err != nil {
+		log.Printf("Failed to reset file %s of upload %s: %v", fileID, uploadID, err)
+	}
+}
+
+var errCorruptPart = errors.New("a stored chunk does not match what was received; upload it again")
+
+// partsReader reads the chunks of a file in order, verifying each chunk's
+// size and checksum as it finishes
+type partsReader struct {
+	ctx     context.Context
+	parts   []mongo.UploadPart
+	next    int
+	current io.ReadCloser
+	hasher  hash.Hash
+	read    int64
+}
+
+func (r *partsReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if r.next == len(r.parts) {
+				return 0, io.EOF
+			}
+			rc, err := config.Storage.Get(r.ctx, r.parts[r.next].ObjectKey)
+			if err != nil {
+				return 0, fmt.Errorf("%w (offset %d: %v)", errCorruptPart, r.parts[r.next].Offset, err)
+			}
+			r.current, r.hasher, r.read = rc, sha256.New(), 0
+		}
+
+		n, err := r.current.Read(p)
+		r.hasher.Write(p[:n])
+		r.read += int64(n)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			part := r.parts[r.next]
+			r.next++
+			if r.read != part.Size || hex.EncodeToString(r.hasher.Sum(nil)) != part.Checksum {
+				return n, fmt.Errorf("%w (offset %d)", errCorruptPart, part.Offset)
+			}
+		} else if err != nil {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// Seek only rewinds to the first chunk, which is all storing needs
+func (r *partsReader) Seek(offset int64, whence int) (int64, error) {
+	if offset != 0 || whence != io.SeekStart {
+		return 0, errors.New("chunks can only be read again from the start")
+	}
+	r.Close()
+	r.current, r.next = nil, 0
+	return 0, nil
+}
+
+func (r *partsReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
+
+func loadUpload(ctx context.Context, repoID, uploadID string) (*mongo.UploadSession, error) {
+	var session mongo.UploadSession
+	filter := bson.M{"uploadId": uploadID, "repoId": repoID}
+	if err := config.UploadCollection.FindOne(ctx, filter).Decode(&session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// setUploadStatus moves an upload out of status from, failing when another
+// request got there first
+func setUploadStatus(uploadID, from string, set bson.M) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	set["updatedAt"] = time.Now().Unix()
+	filter := bson.M{"uploadId": uploadID, "status": from}
+	result, err := config.UploadCollection.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return ErrDatabaseOp
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("upload is no longer " + from)
+	}
+	return nil
+}
+
+func findUploadFile(session *mongo.UploadSession, fileID string) *mongo.UploadFile {
+	for i := range session.Files {
+		if session.Files[i].FileID == fileID {
+			return &session.Files[i]
+		}
+	}
+	return nil
+}
+
+// assetKindFor keeps a known asset kind or guesses one from the file name
+func assetKindFor(kind, name string) string {
+	switch kind {
+	case mongo.AssetProject, mongo.AssetMixdown, mongo.AssetStem, mongo.AssetSample, mongo.AssetMIDI, mongo.AssetOther:
+		return kind
+	}
+	return guessAssetKind(name)
+}
+
+func sortedParts(file *mongo.UploadFile) []mongo.UploadPart {
+	parts := append([]mongo.UploadPart(nil), file.Parts...)
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Offset < parts[j].Offset })
+	return parts
+}
+
+// missingRanges lists the bytes of a file no chunk has covered yet
+func missingRanges(file *mongo.UploadFile) []ByteRange {
+	missing := []ByteRange{}
+	if file.ObjectKey != "" {
+		return missing
+	}
+	var pos int64
+	for _, part := range sortedParts(file) {
+		if part.Offset > pos {
+			missing = append(missing, ByteRange{Start: pos, End: part.Offset})
+		}
+		pos = max(pos, part.Offset+part.Size)
+	}
+	if pos < file.Size {
+		missing = append(missing, ByteRange{Start: pos, End: file.Size})
+	}
+	return missing
+}
+
+func uploadFileStatus(file *mongo.UploadFile) UploadFileStatus {
+	missing := missingRanges(file)
+	received := file.Size
+	for _, r := range missing {
+		received -= r.End - r.Start
+	}
+	return UploadFileStatus{
+		FileID:   file.FileID,
+		Name:     file.Name,
+		Kind:     file.Kind,
+		Size:     file.Size,
+		Received: received,
+		Missing:  missing,
+		Reused:   file.ObjectKey != "",
+	}
+}
+
+func uploadStatus(session *mongo.UploadSession) UploadStatus {
+	status := UploadStatus{
+		UploadID:     session.UploadID,
+		Status:       session.Status,
+		VersionID:    session.VersionID,
+		ExpiresAt:    session.ExpiresAt,
+		MaxChunkSize: maxChunkSize,
+		Files:        make([]UploadFileStatus, 0, len(session.Files)),
+	}
+	for i := range session.Files {
+		status.Files = append(status.Files, uploadFileStatus(&session.Files[i]))
+		if session.Files[i].ObjectKey != "" {
+			status.BytesSaved += session.Files[i].Size
+		}
+	}
+	return status
+}
+
+func discardParts(session *mongo.UploadSession) {
+	for _, file := range session.Files {
+		for _, part := range file.Parts {
+			discardObject(part.ObjectKey)
+		}
+	}
+}
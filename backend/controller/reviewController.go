@@ -0,0 +1,402 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"prodhub-backend/config"
+	"prodhub-backend/helpers"
+	"prodhub-backend/models/mongo"
+)
+
+type ReviewInput struct {
+	Title        string `json:"title" binding:"required,min=1,max=200"`
+	Description  string `json:"description"`
+	SourceRepoID string `json:"sourceRepoId"` // Defaults to the target repository
+	SourceBranch string `json:"sourceBranch" binding:"required"`
+	TargetBranch string `json:"targetBranch" binding:"required"`
+}
+
+type ReviewCommentInput struct {
+	Body string `json:"body" binding:"required,min=1,max=5000"`
+}
+
+type ReviewMergeInput struct {
+	Strategy string `form:"strategy" json:"strategy" binding:"omitempty,oneof=theirs ours upload"`
+	Message  string `form:"message" json:"message"`
+}
+
+var ErrReviewNotFound = errors.New("review request not found")
+
+func findReview(repo *mongo.Repo, reviewID string) *mongo.ReviewRequest {
+	for i := range repo.Reviews {
+		if repo.Reviews[i].ReviewID == reviewID {
+			return &repo.Reviews[i]
+		}
+	}
+	return nil
+}
+
+// loadReviewSource returns the repository and branch a review request proposes changes from
+func loadReviewSource(ctx context.Context, target *mongo.Repo, review *mongo.ReviewRequest) (*mongo.Repo, *mongo.Branch, error) {
+	source := target
+	if review.SourceRepoID != target.RepoID {
+		source = &mongo.Repo{}
+		if err := config.RepoCollection.FindOne(ctx, bson.M{"repoId": review.SourceRepoID}).Decode(source); err != nil {
+			return nil, nil, ErrRepoNotFound
+		}
+	}
+	branch := findBranch(source, review.SourceBranch)
+	if branch == nil {
+		return nil, nil, ErrBranchNotFound
+	}
+	return source, branch, nil
+}
+
+// Open a review request. The source branch is either on this repository or on one of its forks.
+func CreateReview(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	userID, _ := c.Get("userID")
+	target := c.MustGet("repo").(mongo.Repo)
+
+	var input ReviewInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		sendErrorResponse(c, http.StatusBadRequest, ErrInvalidInput)
+		return
+	}
+	if input.SourceRepoID == "" {
+		input.SourceRepoID = target.RepoID
+	}
+	if input.SourceRepoID == target.RepoID && input.SourceBranch == input.TargetBranch {
+		sendErrorResponse(c, http.StatusBadRequest, errors.New("source and target branch are the same"))
+		return
+	}
+	if findBranch(&target, input.TargetBranch) == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrBranchNotFound)
+		return
+	}
+
+	review := mongo.ReviewRequest{
+		ReviewID:     uuid.New().String(),
+		Title:        input.Title,
+		Description:  input.Description,
+		AuthorID:     userID.(string),
+		SourceRepoID: input.SourceRepoID,
+		SourceBranch: input.SourceBranch,
+		TargetBranch: input.TargetBranch,
+		Status:       mongo.ReviewOpen,
+		Approvals:    []mongo.ReviewApproval{},
+		Comments:     []mongo.ReviewComment{},
+	}
+
+	source, branch, err := loadReviewSource(ctx, &target, &review)
+	if err != nil {
+		sendErrorResponse(c, http.StatusNotFound, err)
+		return
+	}
+	if source.RepoID != target.RepoID && (source.ForkedFrom == nil || source.ForkedFrom.RepoID != target.RepoID) {
+		sendErrorResponse(c, http.StatusBadRequest, errors.New("source repository is not a fork of this repository"))
+		return
+	}
+	// Proposing changes needs the same access as uploading them
+	if helpers.RepoAccess(source, userID.(string)) < helpers.AccessContribute {
+		sendErrorResponse(c, http.StatusForbidden, errors.New("Access denied"))
+		return
+	}
+	if branch.HeadVersionID == "" {
+		sendErrorResponse(c, http.StatusBadRequest, errors.New("source branch has no versions to propose"))
+		return
+	}
+
+	now := time.Now().Unix()
+	review.CreatedAt = now
+	review.UpdatedAt = now
+	update := bson.M{
+		"$push": bson.M{
+			"reviews":  review,
+			"activity": mongo.Activity{Date: now, Description: fmt.Sprintf("Opened review request '%s'", review.Title)},
+		},
+		"$set": bson.M{"updatedAt": now},
+	}
+	if _, err := config.RepoCollection.UpdateOne(ctx, bson.M{"repoId": target.RepoID}, update); err != nil {
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+	c.JSON(http.StatusCreated, review)
+}
+
+// List review requests, optionally filtered by ?status=open|merged|closed
+func GetReviews(c *gin.Context) {
+	repo := c.MustGet("repo").(mongo.Repo)
+	status := c.Query("status")
+
+	reviews := []mongo.ReviewRequest{}
+	for _, review := range repo.Reviews {
+		if status == "" || review.Status == status {
+			reviews = append(reviews, review)
+		}
+	}
+	c.JSON(http.StatusOK, reviews)
+}
+
+// Get a review request with its comment thread and the version it proposes
+func GetReview(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repo := c.MustGet("repo").(mongo.Repo)
+
+	review := findReview(&repo, c.Param("reviewId"))
+	if review == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrReviewNotFound)
+		return
+	}
+
+	response := gin.H{"review": review, "proposedVersion": nil}
+	if _, branch, err := loadReviewSource(ctx, &repo, review); err == nil {
+		for _, v := range branch.Versions {
+			if v.VersionID == branch.HeadVersionID {
+				response["proposedVersion"] = v
+			}
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Comment on a review request
+func CommentOnReview(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repoID := c.Param("id")
+	reviewID := c.Param("reviewId")
+	userID, _ := c.Get("userID")
+
+	var input ReviewCommentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		sendErrorResponse(c, http.StatusBadRequest, ErrInvalidInput)
+		return
+	}
+
+	now := time.Now().Unix()
+	comment := mongo.ReviewComment{
+		CommentID: uuid.New().String(),
+		AuthorID:  userID.(string),
+		Body:      input.Body,
+		CreatedAt: now,
+	}
+	filter := bson.M{"repoId": repoID, "reviews.reviewId": reviewID}
+	update := bson.M{
+		"$push": bson.M{"reviews.$.comments": comment},
+		"$set":  bson.M{"reviews.$.updatedAt": now},
+	}
+	result, err := config.RepoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+	if result.MatchedCount == 0 {
+		sendErrorResponse(c, http.StatusNotFound, ErrReviewNotFound)
+		return
+	}
+	c.JSON(http.StatusCreated, comment)
+}
+
+// Approve a review request. Contributors and above other than the author may
+// approve; the approval covers the source head at that moment.
+func ApproveReview(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	userID, _ := c.Get("userID")
+	repo := c.MustGet("repo").(mongo.Repo)
+
+	review := findReview(&repo, c.Param("reviewId"))
+	if review == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrReviewNotFound)
+		return
+	}
+	if review.AuthorID == userID {
+		sendErrorResponse(c, http.StatusBadRequest, errors.New("cannot approve your own review request"))
+		return
+	}
+	_, branch, err := loadReviewSource(ctx, &repo, review)
+	if err != nil {
+		sendErrorResponse(c, http.StatusNotFound, err)
+		return
+	}
+
+	now := time.Now().Unix()
+	approval := mongo.ReviewApproval{UserID: userID.(string), VersionID: branch.HeadVersionID, ApprovedAt: now}
+	filter := bson.M{
+		"repoId": repo.RepoID,
+		"reviews": bson.M{"$elemMatch": bson.M{
+			"reviewId":  review.ReviewID,
+			"status":    mongo.ReviewOpen,
+			"approvals": bson.M{"$not": bson.M{"$elemMatch": bson.M{"userId": userID, "versionId": branch.HeadVersionID}}},
+		}},
+	}
+	update := bson.M{
+		"$push": bson.M{"reviews.$.approvals": approval},
+		"$set":  bson.M{"reviews.$.updatedAt": now},
+	}
+	result, err := config.RepoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+	if result.MatchedCount == 0 {
+		sendErrorResponse(c, http.StatusConflict, errors.New("review request is not open or you already approved its latest version"))
+		return
+	}
+	c.JSON(http.StatusOK, approval)
+}
+
+// Close a review request without merging. The author and maintainers may close it.
+func CloseReview(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	userID, _ := c.Get("userID")
+	repo := c.MustGet("repo").(mongo.Repo)
+
+	review := findReview(&repo, c.Param("reviewId"))
+	if review == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrReviewNotFound)
+		return
+	}
+	if review.AuthorID != userID && helpers.RepoAccess(&repo, userID.(string)) < helpers.AccessMaintain {
+		sendErrorResponse(c, http.StatusForbidden, errors.New("Access denied"))
+		return
+	}
+	if err := setReviewStatus(ctx, repo.RepoID, review.ReviewID, mongo.ReviewOpen, bson.M{"reviews.$.status": mongo.ReviewClosed}); err != nil {
+		sendErrorResponse(c, http.StatusConflict, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Review request closed"})
+}
+
+// Merge a review request. The proposed head is brought into the target branch,
+// fast-forwarding when possible and otherwise creating a merge version that
+// takes the proposed file unless another strategy is given.
+func MergeReview(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Second)
+	defer cancel()
+	userID, _ := c.Get("userID")
+	repo := c.MustGet("repo").(mongo.Repo)
+
+	var input ReviewMergeInput
+	if err := c.ShouldBind(&input); err != nil {
+		sendErrorResponse(c, http.StatusBadRequest, ErrInvalidInput)
+		return
+	}
+	if input.Strategy == "" {
+		input.Strategy = MergeTakeTheirs
+	}
+
+	review := findReview(&repo, c.Param("reviewId"))
+	if review == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrReviewNotFound)
+		return
+	}
+	if review.Status != mongo.ReviewOpen {
+		sendErrorResponse(c, http.StatusConflict, fmt.Errorf("review request is %s", review.Status))
+		return
+	}
+
+	_, sourceBranch, err := loadReviewSource(ctx, &repo, review)
+	if err != nil {
+		sendErrorResponse(c, http.StatusNotFound, err)
+		return
+	}
+	// Versions pushed after an approval were never heard by the approver
+	if !approvedAt(review, sourceBranch.HeadVersionID) {
+		sendErrorResponse(c, http.StatusConflict, errors.New("review request needs an approval of its latest version before it can be merged"))
+		return
+	}
+	target := findBranch(&repo, review.TargetBranch)
+	if target == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrBranchNotFound)
+		return
+	}
+
+	graph := helpers.NewVersionGraph(&repo)
+	graph.Add(sourceBranch.Versions...)
+	plan := planMerge(graph, target, sourceBranch.Versions, sourceBranch.HeadVersionID)
+
+	head := target.HeadVersionID
+	versions := plan.Versions
+	switch {
+	case plan.UpToDate:
+	case plan.FastForward:
+		head = sourceBranch.HeadVersionID
+	default:
+		mergeInput := MergeInput{Source: review.SourceBranch, Target: review.TargetBranch, Strategy: input.Strategy, Message: input.Message}
+		mergeVersion, status, err := buildMergeVersion(c, graph, mergeInput, sourceBranch.HeadVersionID, target.HeadVersionID)
+		if err != nil {
+			sendErrorResponse(c, status, err)
+			return
+		}
+		mergeVersion.Branch = target.Name
+		if mergeVersion.Changes == "" {
+			mergeVersion.Changes = fmt.Sprintf("Merge review request '%s'", review.Title)
+		}
+		versions = append(versions, *mergeVersion)
+		head = mergeVersion.VersionID
+	}
+
+	// Claim the review first so two merges cannot both go through
+	claim := bson.M{
+		"reviews.$.status":          mongo.ReviewMerged,
+		"reviews.$.mergedVersionId": head,
+		"reviews.$.mergedBy":        userID,
+	}
+	if err := setReviewStatus(ctx, repo.RepoID, review.ReviewID, mongo.ReviewOpen, claim); err != nil {
+		sendErrorResponse(c, http.StatusConflict, err)
+		return
+	}
+
+	if !plan.UpToDate {
+		description := fmt.Sprintf("Merged review request '%s' into '%s'", review.Title, target.Name)
+		if err := applyMerge(ctx, &repo, target, versions, head, description); err != nil {
+			setReviewStatus(ctx, repo.RepoID, review.ReviewID, mongo.ReviewMerged, bson.M{"reviews.$.status": mongo.ReviewOpen})
+			sendMergeError(c, err)
+			return
+		}
+		if input.Strategy == MergeUpload && !plan.FastForward {
+			queueAudioAnalysis(repo.RepoID, versions[len(versions)-1].Assets)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Review request merged", "head": head, "fastForward": plan.FastForward})
+}
+
+// approvedAt reports whether someone approved the review at versionID
+func approvedAt(review *mongo.ReviewRequest, versionID string) bool {
+	for _, approval := range review.Approvals {
+		if approval.VersionID == versionID {
+			return true
+		}
+	}
+	return false
+}
+
+// setReviewStatus applies set to a review request that currently has status from
+func setReviewStatus(ctx context.Context, repoID, reviewID, from string, set bson.M) error {
+	set["reviews.$.updatedAt"] = time.Now().Unix()
+	filter := bson.M{
+		"repoId":  repoID,
+		"reviews": bson.M{"$elemMatch": bson.M{"reviewId": reviewID, "status": from}},
+	}
+	result, err := config.RepoCollection.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return ErrDatabaseOp
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("review request is no longer %s", from)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"prodhub-backend/config"
+	"prodhub-backend/models/mongo"
+	"prodhub-backend/music"
+)
+
+// Search defaults
+const (
+	defaultTempoTolerance = 3.0
+	defaultSearchLimit    = 20
+	maxSearchLimit        = 100
+	maxSearchScan         = 1000 // Candidates scored per search, most recently updated first
+)
+
+// mismatchPenalty demotes repos whose audio disagrees with their description
+const mismatchPenalty = 0.5
+
+// searchProjection leaves out the history, which search results do not need
+var searchProjection = bson.M{
+	"branches":        0,
+	"versions":        0,
+	"activity":        0,
+	"comments":        0,
+	"reviews":         0,
+	"invitations":     0,
+	"pendingTransfer": 0,
+}
+
+// CompatibleRepo is a search result with how well it fits the query
+type CompatibleRepo struct {
+	Repo          mongo.Repo
+	Score         float64 // 0 to 1
+	KeyRelation   music.KeyRelation
+	TempoRelation music.TempoRelation
+	BPMDifference float64
+}
+
+// SearchCompatibleRepos finds public repos that mix with a key and tempo,
+// following the Camelot wheel and allowing half and double time. Query
+// parameters: key, bpm, tolerance (BPM, default 3) and limit.
+func SearchCompatibleRepos(c *gin.Context) {
+	var key *music.Key
+	if raw := c.Query("key"); raw != "" {
+		parsed, err := music.ParseKey(raw)
+		if err != nil {
+			sendErrorResponse(c, http.StatusBadRequest, errors.New("key is not a musical key"))
+			return
+		}
+		key = &parsed
+	}
+
+	bpm, err := queryFloat(c, "bpm", 0)
+	if err != nil || bpm < 0 {
+		sendErrorResponse(c, http.StatusBadRequest, errors.New("bpm must be a positive number"))
+		return
+	}
+	tolerance, err := queryFloat(c, "tolerance", defaultTempoTolerance)
+	if err != nil || tolerance < 0 {
+		sendErrorResponse(c, http.StatusBadRequest, errors.New("tolerance must be a positive number"))
+		return
+	}
+	if key == nil && bpm == 0 {
+		sendErrorResponse(c, http.StatusBadRequest, errors.New("a key or a bpm is required"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSearchLimit)))
+	if err != nil || limit < 1 {
+		sendErrorResponse(c, http.StatusBadRequest, errors.New("limit must be a positive integer"))
+		return
+	}
+	limit = min(limit, maxSearchLimit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The database narrows candidates down to mixable keys and tempos; they
+	// are scored here
+	filter := bson.M{"public": true}
+	if key != nil {
+		filter["description.camelot"] = bson.M{"$in": music.MixableCamelot(*key)}
+	}
+	if bpm > 0 {
+		filter["$or"] = bson.A{
+			bpmRange(bpm, tolerance),
+			bpmRange(bpm/2, tolerance/2),
+			bpmRange(bpm*2, tolerance*2),
+		}
+	}
+	opts := options.Find().
+		SetProjection(searchProjection).
+		SetSort(bson.D{{Key: "updatedAt", Value: -1}}).
+		SetLimit(maxSearchScan)
+	cursor, err := config.RepoCollection.Find(ctx, filter, opts)
+	if err != nil {
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var repos []mongo.Repo
+	if err := cursor.All(ctx, &repos); err != nil {
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+
+	results := []CompatibleRepo{}
+	for _, repo := range repos {
+		if result, ok := rateCompatibility(repo, key, bpm, tolerance); ok {
+			results = append(results, result)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Repo.UpdatedAt > results[j].Repo.UpdatedAt
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// rateCompatibility scores a repo against the query. Repos failing either
+// the key or the tempo are left out.
+func rateCompatibility(repo mongo.Repo, key *music.Key, bpm, tolerance float64) (CompatibleRepo, bool) {
+	result := CompatibleRepo{Repo: repo, Score: 1}
+	desc := repo.Description
+
+	if key != nil {
+		repoKey, err := music.ParseKey(desc.Scale)
+		if err != nil {
+			return result, false
+		}
+		result.KeyRelation = music.Relate(*key, repoKey)
+		if result.KeyRelation == music.Clashing {
+			return result, false
+		}
+		result.Score *= result.KeyRelation.Score()
+		if desc.Detected != nil && desc.Detected.KeyMismatch {
+			result.Score *= mismatchPenalty
+		}
+	}
+
+	if bpm > 0 {
+		relation, score, diff := music.MatchTempo(bpm, float64(desc.BPM), tolerance)
+		if relation == music.TempoApart {
+			return result, false
+		}
+		result.TempoRelation = relation
+		result.BPMDifference = diff
+		result.Score *= score
+		if desc.Detected != nil && desc.Detected.BPMMismatch {
+			result.Score *= mismatchPenalty
+		}
+	}
+
+	result.Score = math.Round(result.Score*1000) / 1000
+	return result, true
+}
+
+// bpmRange matches description BPMs within tolerance of bpm
+func bpmRange(bpm, tolerance float64) bson.M {
+	return bson.M{"description.bpm": bson.M{
+		"$gte": math.Floor(bpm - tolerance),
+		"$lte": math.Ceil(bpm + tolerance),
+	}}
+}
+
+// queryFloat reads an optional numeric query parameter
+func queryFloat(c *gin.Context, name string, fallback float64) (float64, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	return strconv.ParseFloat(raw, 64)
+}
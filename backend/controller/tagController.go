@@ -0,0 +1,366 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"prodhub-backend/config"
+	"prodhub-backend/models/mongo"
+)
+
+type TagInput struct {
+	Name      string `json:"name" binding:"required,min=1,max=100"`
+	VersionID string `json:"versionId" binding:"required"`
+	Message   string `json:"message"`
+}
+
+type ReleaseInput struct {
+	Tag   string `form:"tag" binding:"required"`
+	Title string `form:"title" binding:"required,min=1,max=200"`
+	Notes string `form:"notes"`
+}
+
+var (
+	ErrTagNotFound     = errors.New("tag not found")
+	ErrReleaseNotFound = errors.New("release not found")
+)
+
+// releaseAssetFields lists the multipart fields of a release upload with their
+// asset kinds, in the order deliverables are listed
+var releaseAssetFields = []struct{ Field, Kind string }{
+	{"mixdown", "mixdown"},
+	{"stems", "stem"},
+	{"files", "other"},
+}
+
+func findTag(repo *mongo.Repo, name string) *mongo.Tag {
+	for i := range repo.Tags {
+		if repo.Tags[i].Name == name {
+			return &repo.Tags[i]
+		}
+	}
+	return nil
+}
+
+// Create a Tag
+func CreateTag(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repoID := c.Param("id")
+	userID, _ := c.Get("userID")
+
+	var input TagInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		sendErrorResponse(c, http.StatusBadRequest, ErrInvalidInput)
+		return
+	}
+
+	var repo mongo.Repo
+	if err := config.RepoCollection.FindOne(ctx, bson.M{"repoId": repoID}).Decode(&repo); err != nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrRepoNotFound)
+		return
+	}
+	if findVersion(&repo, input.VersionID) == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrVersionNotFound)
+		return
+	}
+
+	now := time.Now().Unix()
+	tag := mongo.Tag{
+		Name:      input.Name,
+		VersionID: input.VersionID,
+		Message:   input.Message,
+		CreatedBy: userID.(string),
+		CreatedAt: now,
+	}
+
+	// Tags are immutable, so only add the tag if no tag of that name exists yet
+	filter := bson.M{"repoId": repoID, "tags.name": bson.M{"$ne": input.Name}}
+	update := bson.M{
+		"$push": bson.M{
+			"tags":     tag,
+			"activity": mongo.Activity{Date: now, Description: fmt.Sprintf("Tagged version %s as '%s'", input.VersionID, input.Name)},
+		},
+		"$set": bson.M{"updatedAt": now},
+	}
+	result, err := config.RepoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+	if result.MatchedCount == 0 {
+		sendErrorResponse(c, http.StatusConflict, errors.New("tag already exists"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, tag)
+}
+
+// List Tags
+func GetTags(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var repo mongo.Repo
+	if err := config.RepoCollection.FindOne(ctx, bson.M{"repoId": c.Param("id")}).Decode(&repo); err != nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrRepoNotFound)
+		return
+	}
+	if repo.Tags == nil {
+		repo.Tags = []mongo.Tag{}
+	}
+	c.JSON(http.StatusOK, repo.Tags)
+}
+
+// Delete a Tag. Routed for the repository owner only, so tags stay protected.
+func DeleteTag(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repoID := c.Param("id")
+	tagName := c.Param("tagName")
+
+	var repo mongo.Repo
+	if err := config.RepoCollection.FindOne(ctx, bson.M{"repoId": repoID}).Decode(&repo); err != nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrRepoNotFound)
+		return
+	}
+	if findTag(&repo, tagName) == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrTagNotFound)
+		return
+	}
+	for _, release := range repo.Releases {
+		if release.Tag == tagName {
+			sendErrorResponse(c, http.StatusConflict, errors.New("tag is used by a release; delete the release first"))
+			return
+		}
+	}
+
+	now := time.Now().Unix()
+	update := bson.M{
+		"$pull": bson.M{"tags": bson.M{"name": tagName}},
+		"$push": bson.M{"activity": mongo.Activity{Date: now, Description: fmt.Sprintf("Deleted tag '%s'", tagName)}},
+		"$set":  bson.M{"updatedAt": now},
+	}
+	// A release created since the check above keeps the tag
+	filter := bson.M{"repoId": repoID, "releases.tag": bson.M{"$ne": tagName}}
+	result, err := config.RepoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+	if result.MatchedCount == 0 {
+		sendErrorResponse(c, http.StatusConflict, errors.New("tag is used by a release; delete the release first"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Tag deleted successfully"})
+}
+
+// Create a Release from a Tag. Deliverables are sent as multipart files in the
+// "mixdown", "stems" and "files" fields.
+func CreateRelease(c *gin.Context) {
+	ctx := context.Background()
+	repoID := c.Param("id")
+	userID, _ := c.Get("userID")
+
+	var input ReleaseInput
+	if err := c.ShouldBind(&input); err != nil {
+		sendErrorResponse(c, http.StatusBadRequest, ErrInvalidInput)
+		return
+	}
+
+	var repo mongo.Repo
+	if err := config.RepoCollection.FindOne(ctx, bson.M{"repoId": repoID}).Decode(&repo); err != nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrRepoNotFound)
+		return
+	}
+	if findTag(&repo, input.Tag) == nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrTagNotFound)
+		return
+	}
+	for _, release := range repo.Releases {
+		if release.Tag == input.Tag {
+			sendErrorResponse(c, http.StatusConflict, errors.New("tag already has a release"))
+			return
+		}
+	}
+
+	// Claim the tag before uploading, so a release racing for the same tag
+	// fails before any deliverable is stored. The release stays pending, and
+	// hidden from listings, until its deliverables are attached.
+	now := time.Now().Unix()
+	release := mongo.Release{
+		ReleaseID: uuid.New().String(),
+		Tag:       input.Tag,
+		Title:     input.Title,
+		Notes:     input.Notes,
+		Assets:    []mongo.ReleaseAsset{},
+		CreatedBy: userID.(string),
+		CreatedAt: now,
+		Pending:   true,
+	}
+	filter := bson.M{"repoId": repoID, "tags.name": input.Tag, "releases.tag": bson.M{"$ne": input.Tag}}
+	result, err := config.RepoCollection.UpdateOne(ctx, filter, bson.M{"$push": bson.M{"releases": release}})
+	if err != nil {
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+	if result.MatchedCount == 0 {
+		sendErrorResponse(c, http.StatusConflict, errors.New("tag already has a release or was deleted"))
+		return
+	}
+
+	// Deliverables stored before a failure are left unreferenced, and
+	// garbage collection deletes them once their grace period is over
+	assets, status, err := uploadReleaseAssets(c)
+	if err != nil {
+		dropRelease(ctx, repoID, release.ReleaseID)
+		sendErrorResponse(c, status, err)
+		return
+	}
+	release.Assets = assets
+	release.Pending = false
+
+	update := bson.M{
+		"$set":   bson.M{"releases.$[r].assets": assets, "updatedAt": now},
+		"$unset": bson.M{"releases.$[r].pending": ""},
+		"$push": bson.M{
+			"activity": mongo.Activity{Date: now, Description: fmt.Sprintf("Published release '%s'", input.Title)},
+		},
+	}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"r.releaseId": release.ReleaseID}},
+	})
+	keys := make([]string, 0, len(assets))
+	for _, asset := range assets {
+		keys = append(keys, asset.ObjectKey)
+	}
+	if err := retainObjects(ctx, repoID, keys); err != nil {
+		log.Printf("Release %s of repo %s: %v", release.ReleaseID, repoID, err)
+		dropRelease(ctx, repoID, release.ReleaseID)
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+	if _, err := config.RepoCollection.UpdateOne(ctx, bson.M{"repoId": repoID}, update, opts); err != nil {
+		releaseObjects(ctx, repoID, unusedObjectKeys(&repo, keys))
+		dropRelease(ctx, repoID, release.ReleaseID)
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, release)
+}
+
+// uploadReleaseAssets stores the deliverables of a release request
+func uploadReleaseAssets(c *gin.Context) ([]mongo.ReleaseAsset, int, error) {
+	assets := []mongo.ReleaseAsset{}
+	form, err := c.MultipartForm()
+	if err != nil {
+		return assets, 0, nil
+	}
+	for _, field := range releaseAssetFields {
+		for _, header := range form.File[field.Field] {
+			file, err := header.Open()
+			if err != nil {
+				return nil, http.StatusBadRequest, err
+			}
+			objectKey, err := UploadFileUtil(file, header.Filename)
+			file.Close()
+			if err != nil {
+				return nil, http.StatusInternalServerError, fmt.Errorf("failed to upload %s: %v", header.Filename, err)
+			}
+			assets = append(assets, mongo.ReleaseAsset{
+				Name:      header.Filename,
+				Kind:      field.Kind,
+				ObjectKey: objectKey,
+				Size:      header.Size,
+			})
+		}
+	}
+	return assets, 0, nil
+}
+
+// dropRelease removes a release whose tag was claimed but never published
+func dropRelease(ctx context.Context, repoID, releaseID string) {
+	update := bson.M{"$pull": bson.M{"releases": bson.M{"releaseId": releaseID}}}
+	if _, err := config.RepoCollection.UpdateOne(ctx, bson.M{"repoId": repoID}, update); err != nil {
+		log.Printf("Failed to drop release %s of repo %s: %v", releaseID, repoID, err)
+	}
+}
+
+// List Releases
+func GetReleases(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var repo mongo.Repo
+	if err := config.RepoCollection.FindOne(ctx, bson.M{"repoId": c.Param("id")}).Decode(&repo); err != nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrRepoNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, publishedReleases(repo.Releases))
+}
+
+// publishedReleases leaves out releases whose deliverables are still uploading
+func publishedReleases(releases []mongo.Release) []mongo.Release {
+	published := []mongo.Release{}
+	for _, release := range releases {
+		if !release.Pending {
+			published = append(published, release)
+		}
+	}
+	return published
+}
+
+// Delete a Release. The tag it was made from stays in place.
+func DeleteRelease(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repoID := c.Param("id")
+	releaseID := c.Param("releaseId")
+
+	var repo mongo.Repo
+	if err := config.RepoCollection.FindOne(ctx, bson.M{"repoId": repoID}).Decode(&repo); err != nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrRepoNotFound)
+		return
+	}
+
+	// Objects only the deleted release used are no longer referenced
+	remaining := repo
+	remaining.Releases = nil
+	keys := []string{}
+	for _, release := range repo.Releases {
+		if release.ReleaseID != releaseID {
+			remaining.Releases = append(remaining.Releases, release)
+			continue
+		}
+		for _, asset := range release.Assets {
+			keys = append(keys, asset.ObjectKey)
+		}
+	}
+
+	now := time.Now().Unix()
+	filter := bson.M{"repoId": repoID, "releases.releaseId": releaseID}
+	update := bson.M{
+		"$pull": bson.M{"releases": bson.M{"releaseId": releaseID}},
+		"$set":  bson.M{"updatedAt": now},
+	}
+	result, err := config.RepoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+	if result.MatchedCount == 0 {
+		sendErrorResponse(c, http.StatusNotFound, ErrReleaseNotFound)
+		return
+	}
+	releaseObjects(ctx, repoID, unusedObjectKeys(&remaining, keys))
+	c.JSON(http.StatusOK, gin.H{"message": "Release deleted successfully"})
+}
@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"gorm.io/gorm/clause"
+	"prodhub-backend/config"
+	"prodhub-backend/models/mongo"
+	"prodhub-backend/models/postgres"
+)
+
+type TransferInput struct {
+	Username           string `json:"username"`
+	Email              string `json:"email"`
+	KeepAsCollaborator bool   `json:"keepAsCollaborator"`
+}
+
+var ErrTransferNotFound = errors.New("no pending transfer for this user")
+
+// Request to transfer a Repository to another user. The recipient has to accept it.
+func RequestTransfer(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repoID := c.Param("id")
+	userID, _ := c.Get("userID")
+
+	var input TransferInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		sendErrorResponse(c, http.StatusBadRequest, ErrInvalidInput)
+		return
+	}
+
+	recipient, err := findUserByNameOrEmail(input.Username, input.Email)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == ErrUserNotFound {
+			status = http.StatusNotFound
+		} else if err == ErrInvalidInput {
+			status = http.StatusBadRequest
+		}
+		sendErrorResponse(c, status, err)
+		return
+	}
+	if recipient.UserID == userID {
+		sendErrorResponse(c, http.StatusBadRequest, errors.New("you already own this repository"))
+		return
+	}
+
+	now := time.Now().Unix()
+	transfer := mongo.OwnershipTransfer{
+		ToUserID:           recipient.UserID,
+		ToUsername:         recipient.Username,
+		RequestedBy:        userID.(string),
+		KeepAsCollaborator: input.KeepAsCollaborator,
+		CreatedAt:          now,
+	}
+	update := bson.M{
+		"$set": bson.M{"pendingTransfer": transfer, "updatedAt": now},
+		"$push": bson.M{"activity": mongo.Activity{
+			Date:        now,
+			Description: fmt.Sprintf("Requested transfer of ownership to %s", recipient.Username),
+		}},
+	}
+	if _, err := config.RepoCollection.UpdateOne(ctx, bson.M{"repoId": repoID}, update); err != nil {
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+	c.JSON(http.StatusCreated, transfer)
+}
+
+// Cancel a pending transfer
+func CancelTransfer(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repoID := c.Param("id")
+
+	now := time.Now().Unix()
+	filter := bson.M{"repoId": repoID, "pendingTransfer": bson.M{"$exists": true}}
+	update := bson.M{
+		"$unset": bson.M{"pendingTransfer": ""},
+		"$set":   bson.M{"updatedAt": now},
+		"$push":  bson.M{"activity": mongo.Activity{Date: now, Description: "Cancelled transfer of ownership"}},
+	}
+	result, err := config.RepoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+	if result.MatchedCount == 0 {
+		sendErrorResponse(c, http.StatusNotFound, errors.New("no pending transfer"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Transfer cancelled"})
+}
+
+// Decline a transfer addressed to the current user
+func DeclineTransfer(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repoID := c.Param("id")
+	userID, _ := c.Get("userID")
+
+	now := time.Now().Unix()
+	filter := bson.M{"repoId": repoID, "pendingTransfer.toUserId": userID}
+	update := bson.M{
+		"$unset": bson.M{"pendingTransfer": ""},
+		"$set":   bson.M{"updatedAt": now},
+		"$push":  bson.M{"activity": mongo.Activity{Date: now, Description: "Transfer of ownership was declined"}},
+	}
+	result, err := config.RepoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		sendErrorResponse(c, http.StatusInternalServerError, ErrDatabaseOp)
+		return
+	}
+	if result.MatchedCount == 0 {
+		sendErrorResponse(c, http.StatusNotFound, ErrTransferNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Transfer declined"})
+}
+
+// Accept a transfer addressed to the current user. The repo moves between the
+// two users' RepoIDs in one Postgres transaction, which is only committed once
+// the Mongo owner has been switched.
+func AcceptTransfer(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	repoID := c.Param("id")
+	userID, _ := c.Get("userID")
+
+	var repo mongo.Repo
+	if err := config.RepoCollection.FindOne(ctx, bson.M{"repoId": repoID}).Decode(&repo); err != nil {
+		sendErrorResponse(c, http.StatusNotFound, ErrTransferNotFound)
+		return
+	}
+	if repo.Transfer == nil || repo.Transfer.ToUserID != userID {
+		sendErrorResponse(c, http.StatusNotFound, ErrTransferNotFound)
+		return
+	}
+	transfer := *repo.Transfer
+	oldOwnerID := repo.OwnerId
+	newOwnerID := transfer.ToUserID
+
+	tx := config.PostgresDB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var users []postgres.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id IN ?", []string{oldOwnerID, newOwnerID}).
+		Find(&users).Error; err != nil || len(users) != 2 {
+		tx.Rollback()
+		sendErrorResponse(c, http.StatusInternalServerError, errors.New("failed to load users"))
+		return
+	}
+	for i := range users {
+		if users[i].UserID == oldOwnerID {
+			users[i].RepoIDs = removeString(users[i].RepoIDs, repoID)
+		} else {
+			users[i].RepoIDs = append(removeString(users[i].RepoIDs, repoID), repoID)
+		}
+		if err := tx.Model(&users[i]).Update("repo_ids", users[i].RepoIDs).Error; err != nil {
+			tx.Rollback()
+			sendErrorResponse(c, http.StatusInternalServerError, errors.New("failed to update user data"))
+			return
+		}
+	}
+
+	// The new owner no longer needs a collaborator entry; the old one may keep one
+	collaborators := []mongo.Collaborator{}
+	for _, collaborator := range repo.Collaborators {
+		if collaborator.UserID != newOwnerID && collaborator.UserID != oldOwnerID {
+			collaborators = append(collaborators, collaborator)
+		}
+	}
+	now := time.Now().Unix()
+	if transfer.KeepAsCollaborator {
+		collaborators = append(collaborators, mongo.Collaborator{UserID: oldOwnerID, Role: mongo.RoleMaintainer, AddedAt: now})
+	}
+
+	filter := bson.M{"repoId": repoID, "ownerId": oldOwnerID, "pendingTransfer.toUserId": newOwnerID}
+	update := bson.M{
+		"$set": bson.M{
+			"ownerId":       newOwnerID,
+			"collaborators": collaborators,
+			"updatedAt":     now,
+		},
+		"$unset": bson.M{"pendingTransfer": ""},
+		"$push": bson.M{"activity": mongo.Activity{
+			Date:        now,
+			Description: fmt.Sprintf("Ownership transferred to %s", transfer.ToUsername),
+		}},
+	}
+	result, err := config.RepoCollection.UpdateOne(ctx, filter, update)
+	if err != nil || result.MatchedCount == 0 {
+		tx.Rollback()
+		sendErrorResponse(c, http.StatusConflict, errors.New("transfer is no longer pending"))
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		revert := bson.M{
+			"$set": bson.M{
+				"ownerId":         oldOwnerID,
+				"collaborators":   repo.Collaborators,
+				"pendingTransfer": transfer,
+			},
+		}
+		if _, revertErr := config.RepoCollection.UpdateOne(ctx, bson.M{"repoId": repoID}, revert); revertErr != nil {
+			log.Printf("Failed to revert owner of repo %s after PostgreSQL commit failure: %v", repoID, revertErr)
+		}
+		sendErrorResponse(c, http.StatusInternalServerError, errors.New("failed to commit transaction"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Ownership transferred", "ownerId": newOwnerID})
+}
+
+// removeString returns list without any occurrence of value
+func removeString(list []string, value string) []string {
+	filtered := make([]string, 0, len(list))
+	for _, v := range list {
+		if v != value {
+			filtered = append(filtered, v)
+		}
+	}
+	return filtered
+}
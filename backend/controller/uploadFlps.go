@@ -3,100 +3,67 @@ package controllers
 
 import (
 	"context"
-	"fmt"
 	"io"
-	"mime/multipart"
-	"time"
 	"net/http"
+	"slices"
+	"time"
 
-	"github.com/google/uuid"
-	"prodhub-backend/config"
 	"github.com/gin-gonic/gin"
+	"prodhub-backend/models/mongo"
 )
 
-// UploadFile handles uploading a file to Firebase Storage
+// UploadFile handles uploading a file to the configured object storage
 func UploadFile(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*50)
-	defer cancel()
-
-	file,fileHeader,err := c.Request.FormFile("file")
-	
-
-
-
+	file, fileHeader, err := c.Request.FormFile("file")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error":"Failed to get file from request"+ err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get file from request" + err.Error()})
 		return
 	}
 	defer file.Close()
 
-	fileName := fileHeader.Filename
-	var BucketName=config.BucketName
-	fmt.Print("Uploadin in Bucket Name:",BucketName)
-	if config.StorageClient == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "storage bucket is not initialized"})
-		return
+	var project *mongo.ProjectInfo
+	if isProjectFile(fileHeader.Filename) {
+		if project, err = readProjectInfo(file); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
 
-	// Generate unique object name
-	objectName := fmt.Sprintf("%s/%s", uuid.New().String(), fileName)
-
-	// Create a new bucket writer
-	writer := config.StorageClient.Object(objectName).NewWriter(ctx)
-	writer.ContentType = "application/octet-stream"
-
-	// Copy the file data to the bucket
-	bytesCopied, err := io.Copy(writer, file)
+	content, err := storeContent(ctx, file, fileHeader.Filename)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("failed to copy file data (bytes copied: %d): %v", bytesCopied, err),
-		})
-		return
-	}
-
-	// Close the writer
-	if err := writer.Close(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("failed to close writer: %v", err),
-		})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Generate the public URL for the uploaded file
-	fileURL := fmt.Sprintf("https://storage.googleapis.com/%s/%s", BucketName, objectName)
-
-	c.JSON(http.StatusOK, gin.H{"url": fileURL})
+	c.JSON(http.StatusOK, gin.H{"key": content.ObjectKey, "project": project})
 }
 
-func UploadFileUtil(file multipart.File, fileName string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*50)
-	defer cancel()
-
-	if config.StorageClient == nil {
-		return "", fmt.Errorf("storage bucket is not initialized")
-	}
-
-	// Generate unique object name
-	objectName := fmt.Sprintf("%s/%s", uuid.New().String(), fileName)
+// uploadTimeout bounds an upload made in a single request. Larger files go
+// through resumable uploads instead.
+const uploadTimeout = 50 * time.Second
 
-	// Create a new bucket writer
-	writer := config.StorageClient.Object(objectName).NewWriter(ctx)
-	writer.ContentType = "application/octet-stream"
+// UploadFileUtil stores file under the hash of its contents and returns the
+// object name. Objects are private; they are fetched through the download endpoints.
+func UploadFileUtil(file io.ReadSeeker, fileName string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
 
-	// Copy the file data to the bucket
-	bytesCopied, err := io.Copy(writer, file)
+	content, err := storeContent(ctx, file, fileName)
 	if err != nil {
-		return "", fmt.Errorf("failed to copy file data (bytes copied: %d): %v", bytesCopied, err)
+		return "", err
 	}
+	return content.ObjectKey, nil
+}
 
-	// Close the writer
-	if err := writer.Close(); err != nil {
-		return "", fmt.Errorf("failed to close writer: %v", err)
+// bytesSaved is how much storing content for repoID added nothing to the
+// bucket. Only contents the repo already used count, so the figure never
+// reveals what other repos store.
+func bytesSaved(content storedContent, repoID string) int64 {
+	if content.Reused && slices.Contains(content.Repos, repoID) {
+		return content.Size
 	}
-
-	// Generate the public URL for the uploaded file
-	fileURL := fmt.Sprintf("https://storage.googleapis.com/%s/%s", config.BucketName, objectName)
-
-	return fileURL, nil
-}
\ No newline at end of file
+	return 0
+}
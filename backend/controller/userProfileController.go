@@ -3,11 +3,13 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"time"
 
 	"prodhub-backend/config"
+	"prodhub-backend/helpers"
 	"prodhub-backend/models/mongo"
 	"prodhub-backend/models/postgres"
 
@@ -113,7 +115,18 @@ func GetUserRepos(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode repos"})
 		return
 	}
-	c.JSON(http.StatusOK, repos)
+	// Private repos are only listed for those who can read them
+	viewerID := c.GetString("userID")
+	visible := []mongo.Repo{}
+	for i := range repos {
+		access := helpers.RepoAccess(&repos[i], viewerID)
+		if access < helpers.AccessRead {
+			continue
+		}
+		redactRepo(&repos[i], access)
+		visible = append(visible, repos[i])
+	}
+	c.JSON(http.StatusOK, visible)
 }
 
 // LikeRepo allows a user to like a repository
@@ -149,6 +162,9 @@ func LikeRepo(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to like repo"})
 		return
 	}
+	if err := adjustLikes(repoID, 1); err != nil {
+		log.Printf("Failed to count like of repo %s: %v", repoID, err)
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Repo liked"})
 }
 
@@ -172,13 +188,29 @@ func UnlikeRepo(c *gin.Context) {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlike repo"})
 				return
 			}
+			if err := adjustLikes(repoID, -1); err != nil {
+				log.Printf("Failed to count unlike of repo %s: %v", repoID, err)
+			}
 			c.JSON(http.StatusOK, gin.H{"message": "Repo unliked successfully"})
 			return
 		}
 	}
 	c.JSON(http.StatusBadRequest, gin.H{"error": "Repo not found in liked list"})
 }
-			
+
+// adjustLikes moves the like counter of a repository, which the listing sorts by
+func adjustLikes(repoID string, delta int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"repoId": repoID}
+	if delta < 0 {
+		filter["likes"] = bson.M{"$gt": 0}
+	}
+	_, err := config.RepoCollection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"likes": delta}})
+	return err
+}
+
 // CreateUser creates a new user
 func CreateUser(c *gin.Context) {
 	var input struct {
@@ -0,0 +1,145 @@
+package flp
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TempoChange records a tempo change between two projects
+type TempoChange struct {
+	From float64 `json:"from"`
+	To   float64 `json:"to"`
+}
+
+// StringChange records a changed text value such as the time signature
+type StringChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// CountChange records a changed count such as the number of patterns
+type CountChange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// ChannelRename is a channel whose index stayed the same but whose name changed
+type ChannelRename struct {
+	Index int    `json:"index"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// ChannelPluginChange is a channel that now hosts a different plugin
+type ChannelPluginChange struct {
+	Index   int    `json:"index"`
+	Channel string `json:"channel"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+}
+
+// Diff is the structured difference between two projects
+type Diff struct {
+	Tempo           *TempoChange          `json:"tempo,omitempty"`
+	TimeSignature   *StringChange         `json:"timeSignature,omitempty"`
+	FLVersion       *StringChange         `json:"flVersion,omitempty"`
+	PatternCount    *CountChange          `json:"patternCount,omitempty"`
+	ChannelsAdded   []Channel             `json:"channelsAdded"`
+	ChannelsRemoved []Channel             `json:"channelsRemoved"`
+	ChannelsRenamed []ChannelRename       `json:"channelsRenamed"`
+	PluginsAdded    []string              `json:"pluginsAdded"`
+	PluginsRemoved  []string              `json:"pluginsRemoved"`
+	PluginChanges   []ChannelPluginChange `json:"pluginChanges"`
+	SamplesAdded    []string              `json:"samplesAdded"`
+	SamplesRemoved  []string              `json:"samplesRemoved"`
+}
+
+// Empty reports whether the two compared projects had no differences
+func (d *Diff) Empty() bool {
+	return d.Tempo == nil && d.TimeSignature == nil && d.FLVersion == nil && d.PatternCount == nil &&
+		len(d.ChannelsAdded) == 0 && len(d.ChannelsRemoved) == 0 && len(d.ChannelsRenamed) == 0 &&
+		len(d.PluginsAdded) == 0 && len(d.PluginsRemoved) == 0 && len(d.PluginChanges) == 0 &&
+		len(d.SamplesAdded) == 0 && len(d.SamplesRemoved) == 0
+}
+
+// Compare returns what changed going from one project to the other. Channels
+// are matched by their channel rack index, which FL Studio keeps stable.
+func Compare(from, to *Project) *Diff {
+	d := &Diff{
+		ChannelsAdded:   []Channel{},
+		ChannelsRemoved: []Channel{},
+		ChannelsRenamed: []ChannelRename{},
+		PluginChanges:   []ChannelPluginChange{},
+	}
+
+	if from.Tempo != to.Tempo {
+		d.Tempo = &TempoChange{From: from.Tempo, To: to.Tempo}
+	}
+	if fromSig, toSig := timeSignature(from), timeSignature(to); fromSig != toSig {
+		d.TimeSignature = &StringChange{From: fromSig, To: toSig}
+	}
+	if from.FLVersion != to.FLVersion {
+		d.FLVersion = &StringChange{From: from.FLVersion, To: to.FLVersion}
+	}
+	if from.PatternCount != to.PatternCount {
+		d.PatternCount = &CountChange{From: from.PatternCount, To: to.PatternCount}
+	}
+
+	fromChannels := map[int]Channel{}
+	for _, ch := range from.Channels {
+		fromChannels[ch.Index] = ch
+	}
+	toChannels := map[int]bool{}
+	for _, ch := range to.Channels {
+		toChannels[ch.Index] = true
+		old, ok := fromChannels[ch.Index]
+		if !ok {
+			d.ChannelsAdded = append(d.ChannelsAdded, ch)
+			continue
+		}
+		if old.Name != ch.Name {
+			d.ChannelsRenamed = append(d.ChannelsRenamed, ChannelRename{Index: ch.Index, From: old.Name, To: ch.Name})
+		}
+		if old.Plugin != ch.Plugin {
+			d.PluginChanges = append(d.PluginChanges, ChannelPluginChange{Index: ch.Index, Channel: ch.Name, From: old.Plugin, To: ch.Plugin})
+		}
+	}
+	for _, ch := range from.Channels {
+		if !toChannels[ch.Index] {
+			d.ChannelsRemoved = append(d.ChannelsRemoved, ch)
+		}
+	}
+
+	d.PluginsAdded, d.PluginsRemoved = setDiff(from.Plugins, to.Plugins)
+	d.SamplesAdded, d.SamplesRemoved = setDiff(from.Samples, to.Samples)
+	return d
+}
+
+func timeSignature(p *Project) string {
+	return fmt.Sprintf("%d/%d", p.TimeSigNum, p.TimeSigBeat)
+}
+
+// setDiff returns the values only present in to (added) and only present in from (removed)
+func setDiff(from, to []string) ([]string, []string) {
+	inFrom := map[string]bool{}
+	for _, v := range from {
+		inFrom[v] = true
+	}
+	inTo := map[string]bool{}
+	added := []string{}
+	for _, v := range to {
+		inTo[v] = true
+		if !inFrom[v] {
+			added = append(added, v)
+		}
+	}
+	removed := []string{}
+	for _, v := range from {
+		if !inTo[v] {
+			removed = append(removed, v)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
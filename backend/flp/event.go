@@ -0,0 +1,201 @@
+package flp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Event kinds are encoded in the event ID range:
+// 0-63 carry one byte, 64-127 a word, 128-191 a dword and 192-255 a
+// variable-length payload prefixed with its size.
+const (
+	wordEventStart  = 64
+	dwordEventStart = 128
+	textEventStart  = 192
+	dataEventStart  = 208
+)
+
+// Event IDs understood by the parser
+const (
+	evTimeSigNum         = 17
+	evTimeSigBeat        = 18
+	evChannelType        = 21
+	evChannelNew         = 64
+	evPatternNew         = 65
+	evTempoCoarse        = 66
+	evTempoFine          = 93
+	evSlotIndex          = 98
+	evTempo              = 156
+	evFLBuild            = 159
+	evTitle              = 194
+	evSamplePath         = 196
+	evFLVersion          = 199
+	evPluginInternalName = 201
+	evPluginName         = 203
+	evGenre              = 206
+	evArtists            = 207
+	evPluginWrapper      = 212
+	evInsertFlags        = 236
+)
+
+// maxEventSize rejects corrupt size prefixes outright
+const maxEventSize = 256 << 20
+
+// eagerReadSize is the largest payload allocated in one go. Larger payloads
+// grow as their bytes arrive, so a size prefix alone cannot make the parser
+// allocate more than the input holds.
+const eagerReadSize = 64 << 10
+
+var (
+	// ErrInvalidHeader is returned when the input does not start with an FLhd chunk
+	ErrInvalidHeader = errors.New("flp: not an FL Studio project file")
+	// ErrTruncated is returned when the data chunk ends in the middle of an event
+	ErrTruncated = errors.New("flp: truncated event data")
+)
+
+// header is the content of the FLhd chunk
+type header struct {
+	Format   int16
+	Channels uint16
+	PPQ      uint16
+}
+
+// event is a single decoded entry of the FLdt chunk. Value holds the payload of
+// byte/word/dword events, Data the payload of text and data events.
+type event struct {
+	ID    byte
+	Value uint32
+	Data  []byte
+}
+
+type decoder struct {
+	r      *bufio.Reader
+	remain int64
+}
+
+// newDecoder reads the FLhd and FLdt chunk headers and returns a decoder
+// positioned at the first event
+func newDecoder(r io.Reader) (*decoder, header, error) {
+	br := bufio.NewReader(r)
+	var h header
+
+	var magic [4]byte
+	var size uint32
+	if _, err := io.ReadFull(br, magic[:]); err != nil || string(magic[:]) != "FLhd" {
+		return nil, h, ErrInvalidHeader
+	}
+	if err := binary.Read(br, binary.LittleEndian, &size); err != nil || size < 6 {
+		return nil, h, ErrInvalidHeader
+	}
+	if err := binary.Read(br, binary.LittleEndian, &h); err != nil {
+		return nil, h, ErrInvalidHeader
+	}
+	// Skip any header fields newer versions may add
+	if _, err := br.Discard(int(size) - 6); err != nil {
+		return nil, h, ErrInvalidHeader
+	}
+
+	if _, err := io.ReadFull(br, magic[:]); err != nil || string(magic[:]) != "FLdt" {
+		return nil, h, fmt.Errorf("flp: missing FLdt chunk")
+	}
+	if err := binary.Read(br, binary.LittleEndian, &size); err != nil {
+		return nil, h, ErrTruncated
+	}
+
+	return &decoder{r: br, remain: int64(size)}, h, nil
+}
+
+// next returns the next event, or io.EOF once the data chunk is exhausted
+func (d *decoder) next() (event, error) {
+	var ev event
+	if d.remain <= 0 {
+		return ev, io.EOF
+	}
+
+	id, err := d.readByte()
+	if err != nil {
+		return ev, err
+	}
+	ev.ID = id
+
+	switch {
+	case id < wordEventStart:
+		b, err := d.readByte()
+		ev.Value = uint32(b)
+		return ev, err
+	case id < dwordEventStart:
+		buf, err := d.read(2)
+		if err == nil {
+			ev.Value = uint32(binary.LittleEndian.Uint16(buf))
+		}
+		return ev, err
+	case id < textEventStart:
+		buf, err := d.read(4)
+		if err == nil {
+			ev.Value = binary.LittleEndian.Uint32(buf)
+		}
+		return ev, err
+	}
+
+	size, err := d.readVarint()
+	if err != nil {
+		return ev, err
+	}
+	if size > maxEventSize {
+		return ev, fmt.Errorf("flp: event %d too large (%d bytes)", id, size)
+	}
+	ev.Data, err = d.read(int(size))
+	return ev, err
+}
+
+func (d *decoder) readByte() (byte, error) {
+	if d.remain < 1 {
+		return 0, ErrTruncated
+	}
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return 0, ErrTruncated
+	}
+	d.remain--
+	return b, nil
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+	if int64(n) > d.remain {
+		return nil, ErrTruncated
+	}
+	if n > eagerReadSize {
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, d.r, int64(n)); err != nil {
+			return nil, ErrTruncated
+		}
+		d.remain -= int64(n)
+		return buf.Bytes(), nil
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		return nil, ErrTruncated
+	}
+	d.remain -= int64(n)
+	return buf, nil
+}
+
+// readVarint decodes the 7-bit little-endian size prefix of text/data events
+func (d *decoder) readVarint() (uint64, error) {
+	var v uint64
+	for shift := 0; shift < 35; shift += 7 {
+		b, err := d.readByte()
+		if err != nil {
+			return 0, err
+		}
+		v |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("flp: malformed event size")
+}
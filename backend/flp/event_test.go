@@ -0,0 +1,157 @@
+package flp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+)
+
+// buildProject wraps events in the FLhd and FLdt chunks of a project file.
+// dataSize overrides the FLdt length when it is not negative.
+func buildProject(events []byte, dataSize int64) []byte {
+	var b bytes.Buffer
+	b.WriteString("FLhd")
+	binary.Write(&b, binary.LittleEndian, uint32(6))
+	binary.Write(&b, binary.LittleEndian, header{Format: 0, Channels: 1, PPQ: 96})
+	b.WriteString("FLdt")
+	if dataSize < 0 {
+		dataSize = int64(len(events))
+	}
+	binary.Write(&b, binary.LittleEndian, uint32(dataSize))
+	b.Write(events)
+	return b.Bytes()
+}
+
+// varint encodes the size prefix of a text or data event
+func varint(n uint64) []byte {
+	var b []byte
+	for {
+		c := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// textEvent encodes a variable-length event
+func textEvent(id byte, data []byte) []byte {
+	return append(append([]byte{id}, varint(uint64(len(data)))...), data...)
+}
+
+func TestDecoderVarintSizes(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"one byte prefix", 127},
+		{"two byte prefix", 128},
+		{"two byte prefix upper bound", 16383},
+		{"three byte prefix", 16384},
+		{"grown payload", eagerReadSize + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := bytes.Repeat([]byte{'x'}, tt.size)
+			d, _, err := newDecoder(bytes.NewReader(buildProject(textEvent(evTitle, data), -1)))
+			if err != nil {
+				t.Fatalf("newDecoder: %v", err)
+			}
+			ev, err := d.next()
+			if err != nil {
+				t.Fatalf("next: %v", err)
+			}
+			if ev.ID != evTitle || !bytes.Equal(ev.Data, data) {
+				t.Errorf("got event %d with %d bytes, want %d with %d", ev.ID, len(ev.Data), evTitle, tt.size)
+			}
+			if _, err := d.next(); err != io.EOF {
+				t.Errorf("next after last event = %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestParseTextEvents(t *testing.T) {
+	utf16 := func(s string) []byte {
+		var b []byte
+		for _, r := range s {
+			b = binary.LittleEndian.AppendUint16(b, uint16(r))
+		}
+		return append(b, 0, 0)
+	}
+	tests := []struct {
+		name    string
+		version string
+		title   []byte
+		want    string
+	}{
+		{"ascii before 11.5", "11.0.0", []byte("Old song\x00"), "Old song"},
+		{"utf-16 from 11.5", "20.8.4", utf16("New song"), "New song"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var events []byte
+			events = append(events, textEvent(evFLVersion, []byte(tt.version+"\x00"))...)
+			events = append(events, textEvent(evTitle, tt.title)...)
+			events = append(events, evTempo, 0x20, 0xbf, 0x02, 0x00) // 180.000 BPM
+			p, err := Parse(bytes.NewReader(buildProject(events, -1)))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if p.FLVersion != tt.version || p.Title != tt.want || p.Tempo != 180 {
+				t.Errorf("got version %q, title %q, tempo %v", p.FLVersion, p.Title, p.Tempo)
+			}
+		})
+	}
+}
+
+func TestParseRejectsBadInput(t *testing.T) {
+	title := textEvent(evTitle, []byte("Song"))
+	tests := []struct {
+		name  string
+		input []byte
+		want  error
+	}{
+		{"not a project", []byte("RIFF\x04\x00\x00\x00WAVE"), ErrInvalidHeader},
+		{"data chunk ends mid event", buildProject(title[:3], -1), ErrTruncated},
+		{"file shorter than its data chunk", buildProject(title, int64(len(title))+10), ErrTruncated},
+		{"payload larger than the file", buildProject(append([]byte{evTitle}, varint(1<<20)...), 1<<30), ErrTruncated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(bytes.NewReader(tt.input)); !errors.Is(err, tt.want) {
+				t.Errorf("Parse() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRejectsOversizeEvent(t *testing.T) {
+	events := append([]byte{evTitle}, varint(maxEventSize+1)...)
+	_, err := Parse(bytes.NewReader(buildProject(events, 1<<31)))
+	if err == nil || errors.Is(err, ErrTruncated) {
+		t.Errorf("Parse() error = %v, want an oversize event error", err)
+	}
+}
+
+func TestParseDoesNotTrustSizePrefix(t *testing.T) {
+	// A few bytes claiming an event just under the size limit
+	events := append([]byte{evTitle}, varint(maxEventSize)...)
+	input := buildProject(append(events, "tiny"...), 1<<31)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	if _, err := Parse(bytes.NewReader(input)); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("Parse() error = %v, want %v", err, ErrTruncated)
+	}
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("parsing %d bytes allocated %d bytes", len(input), allocated)
+	}
+}
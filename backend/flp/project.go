@@ -0,0 +1,262 @@
+// Package flp decodes FL Studio project (.flp) files far enough to describe
+// what is inside them: tempo, time signature, channels, plugins, patterns and
+// the samples the project references.
+package flp
+
+import (
+	"encoding/binary"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Channel types as stored in the channel type event
+var channelTypes = map[uint32]string{
+	0: "sampler",
+	2: "generator",
+	3: "layer",
+	4: "instrument",
+	5: "automation",
+}
+
+// Channel is a channel rack entry
+type Channel struct {
+	Index      int    `json:"index"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Plugin     string `json:"plugin,omitempty"`
+	SamplePath string `json:"samplePath,omitempty"`
+}
+
+// Project holds the metadata extracted from an FL Studio project
+type Project struct {
+	FLVersion    string    `json:"flVersion"`
+	FLBuild      int       `json:"flBuild"`
+	PPQ          int       `json:"ppq"`
+	Tempo        float64   `json:"tempo"`
+	TimeSigNum   int       `json:"timeSigNum"`
+	TimeSigBeat  int       `json:"timeSigBeat"`
+	Title        string    `json:"title,omitempty"`
+	Genre        string    `json:"genre,omitempty"`
+	Artists      string    `json:"artists,omitempty"`
+	Channels     []Channel `json:"channels"`
+	Plugins      []string  `json:"plugins"`
+	PatternCount int       `json:"patternCount"`
+	Samples      []string  `json:"samples"`
+}
+
+// Parse decodes an FL Studio project read from r
+func Parse(r io.Reader) (*Project, error) {
+	d, h, err := newDecoder(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Project{
+		PPQ:      int(h.PPQ),
+		Channels: []Channel{},
+		Plugins:  []string{},
+		Samples:  []string{},
+	}
+
+	var (
+		unicode                bool
+		channel                *Channel
+		inMixer                bool
+		tempoCoarse, tempoFine uint32
+		patterns               = map[uint32]bool{}
+		plugins                = map[string]bool{}
+		samples                = map[string]bool{}
+		slotPlugin             string
+	)
+
+	for {
+		ev, err := d.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch ev.ID {
+		case evFLVersion:
+			p.FLVersion = decodeASCII(ev.Data)
+			unicode = usesUnicode(p.FLVersion)
+		case evFLBuild:
+			p.FLBuild = int(ev.Value)
+		case evTempo:
+			p.Tempo = float64(ev.Value) / 1000
+		case evTempoCoarse:
+			tempoCoarse = ev.Value
+		case evTempoFine:
+			tempoFine = ev.Value
+		case evTimeSigNum:
+			if p.TimeSigNum == 0 {
+				p.TimeSigNum = int(ev.Value)
+			}
+		case evTimeSigBeat:
+			if p.TimeSigBeat == 0 {
+				p.TimeSigBeat = int(ev.Value)
+			}
+		case evTitle:
+			p.Title = decodeText(ev.Data, unicode)
+		case evGenre:
+			p.Genre = decodeText(ev.Data, unicode)
+		case evArtists:
+			p.Artists = decodeText(ev.Data, unicode)
+		case evPatternNew:
+			patterns[ev.Value] = true
+		case evChannelNew:
+			p.Channels = append(p.Channels, Channel{Index: int(ev.Value), Type: "sampler"})
+			channel = &p.Channels[len(p.Channels)-1]
+		case evChannelType:
+			if channel != nil && !inMixer {
+				if name, ok := channelTypes[ev.Value]; ok {
+					channel.Type = name
+				}
+			}
+		case evSamplePath:
+			if samplePath := decodeText(ev.Data, unicode); samplePath != "" {
+				if channel != nil && !inMixer {
+					channel.SamplePath = samplePath
+				}
+				if !samples[samplePath] {
+					samples[samplePath] = true
+					p.Samples = append(p.Samples, samplePath)
+				}
+			}
+		case evInsertFlags:
+			// Mixer inserts come after the channel rack; plugin events from here
+			// on belong to effect slots instead of channels
+			inMixer = true
+		case evPluginInternalName:
+			name := decodeText(ev.Data, unicode)
+			if inMixer {
+				slotPlugin = name
+			} else if channel != nil {
+				channel.Plugin = name
+			}
+		case evPluginWrapper:
+			name := wrappedPluginName(ev.Data)
+			if name == "" {
+				break
+			}
+			if inMixer {
+				slotPlugin = name
+			} else if channel != nil {
+				channel.Plugin = name
+			}
+		case evPluginName:
+			if !inMixer && channel != nil {
+				channel.Name = decodeText(ev.Data, unicode)
+			}
+		case evSlotIndex:
+			if slotPlugin != "" {
+				plugins[slotPlugin] = true
+			}
+			slotPlugin = ""
+		}
+	}
+
+	if p.Tempo == 0 && tempoCoarse != 0 {
+		p.Tempo = float64(tempoCoarse) + float64(tempoFine)/1000
+	}
+	if p.TimeSigNum == 0 {
+		p.TimeSigNum = 4
+	}
+	if p.TimeSigBeat == 0 {
+		p.TimeSigBeat = 4
+	}
+
+	for i := range p.Channels {
+		ch := &p.Channels[i]
+		if ch.Plugin != "" {
+			plugins[ch.Plugin] = true
+		}
+		if ch.Name == "" {
+			switch {
+			case ch.SamplePath != "":
+				ch.Name = strings.TrimSuffix(samplePathBase(ch.SamplePath), path.Ext(samplePathBase(ch.SamplePath)))
+			case ch.Plugin != "":
+				ch.Name = ch.Plugin
+			default:
+				ch.Name = "Channel " + strconv.Itoa(ch.Index+1)
+			}
+		}
+	}
+
+	for name := range plugins {
+		p.Plugins = append(p.Plugins, name)
+	}
+	sort.Strings(p.Plugins)
+
+	for id := range patterns {
+		if id > 0 {
+			p.PatternCount++
+		}
+	}
+
+	return p, nil
+}
+
+// usesUnicode reports whether text events are UTF-16, which is the case from FL Studio 11.5 on
+func usesUnicode(version string) bool {
+	parts := strings.Split(version, ".")
+	major, _ := strconv.Atoi(parts[0])
+	minor := 0
+	if len(parts) > 1 {
+		minor, _ = strconv.Atoi(parts[1])
+	}
+	return major > 11 || (major == 11 && minor >= 5)
+}
+
+func decodeASCII(b []byte) string {
+	return strings.TrimRight(string(b), "\x00")
+}
+
+func decodeText(b []byte, unicode bool) string {
+	if !unicode {
+		return decodeASCII(b)
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return strings.TrimRight(string(utf16.Decode(u)), "\x00")
+}
+
+// samplePathBase returns the file name of a sample path, which FL Studio
+// stores with Windows separators
+func samplePathBase(p string) string {
+	return path.Base(strings.ReplaceAll(p, "\\", "/"))
+}
+
+// wrappedPluginName extracts the plugin name from the data of a "Fruity
+// Wrapper" event, which hosts VST plugins. The payload is a kind marker followed
+// by records of (id uint32, size uint64, data).
+func wrappedPluginName(b []byte) string {
+	const recordName = 54
+	if len(b) < 4 {
+		return ""
+	}
+	if kind := binary.LittleEndian.Uint32(b); kind != 8 && kind != 10 {
+		return ""
+	}
+	for pos := 4; pos+12 <= len(b); {
+		id := binary.LittleEndian.Uint32(b[pos:])
+		size := binary.LittleEndian.Uint64(b[pos+4:])
+		pos += 12
+		if size > uint64(len(b)-pos) {
+			return ""
+		}
+		if id == recordName {
+			return decodeASCII(b[pos : pos+int(size)])
+		}
+		pos += int(size)
+	}
+	return ""
+}
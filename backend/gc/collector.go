@@ -0,0 +1,349 @@
+// Package gc deletes stored objects that nothing in the database refers to
+// any more: files of deleted repos and branches, uploads whose version was
+// never created, chunks of abandoned resumable uploads and stale peaks.
+package gc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"prodhub-backend/config"
+	"prodhub-backend/models/mongo"
+	"prodhub-backend/storage"
+)
+
+// Prefixes of the objects the service writes
+const (
+	contentPrefix = "objects/sha256/" // Files stored under the hash of their contents
+	uploadsPrefix = "uploads/"        // Chunks of resumable uploads
+	peaksPrefix   = "peaks/"          // Waveform peaks of audio assets
+)
+
+// legacyKey matches the <uuid>/<file name> keys of uploads made before
+// files were stored by content
+var legacyKey = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}/[^/]+$`)
+
+// stuckAssembly is how long an upload may stay completing before it is
+// considered abandoned
+const stuckAssembly = 2 * time.Hour
+
+// Options control a collection run
+type Options struct {
+	DryRun bool          // Only report what would be deleted
+	Grace  time.Duration // Objects younger than this are kept even when unreferenced
+}
+
+// Orphan is a stored object nothing refers to
+type Orphan struct {
+	Key     string
+	Size    int64
+	Updated time.Time
+}
+
+// Report describes a collection run
+type Report struct {
+	Scanned        int      // Objects in the store
+	Referenced     int      // Objects still in use
+	Recent         int      // Unreferenced objects kept because they are inside the grace period
+	Counted        int      // Unreferenced content kept because its reference count says otherwise
+	ExpiredUploads int      // Resumable uploads given up on in this run
+	Orphans        []Orphan // Unreferenced objects past the grace period
+	Deleted        int
+	BytesFreed     int64
+	Failed         int
+}
+
+// Run compares every stored object with the objects referenced from the
+// database and deletes, or with DryRun only reports, the unreferenced ones
+// older than the grace period.
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	now := time.Now()
+	report := &Report{}
+
+	expired, err := expireUploads(ctx, now, opts.DryRun)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire uploads: %v", err)
+	}
+	report.ExpiredUploads = expired
+
+	// Referenced keys are gathered before listing the store, so an object
+	// written in between is at worst young and kept by the grace period
+	referenced, err := referencedKeys(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := listCollectable(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stored objects: %v", err)
+	}
+
+	cutoff := now.Add(-opts.Grace)
+	classify(report, objects, referenced, cutoff)
+	if opts.DryRun {
+		return report, nil
+	}
+
+	for _, orphan := range report.Orphans {
+		if strings.HasPrefix(orphan.Key, contentPrefix) {
+			released, err := forgetContent(ctx, orphan.Key, cutoff)
+			if err != nil {
+				log.Printf("gc: failed to check %s: %v", orphan.Key, err)
+				report.Failed++
+				continue
+			}
+			if !released {
+				report.Counted++
+				continue
+			}
+			if !recheck(ctx, report, orphan.Key, cutoff) {
+				continue
+			}
+		}
+		if err := config.Storage.Delete(ctx, orphan.Key); err != nil {
+			log.Printf("gc: failed to delete %s: %v", orphan.Key, err)
+			report.Failed++
+			continue
+		}
+		report.Deleted++
+		report.BytesFreed += orphan.Size
+	}
+	return report, nil
+}
+
+// classify counts the objects that are referenced or younger than cutoff and
+// lists the others as orphans
+func classify(report *Report, objects []storage.ObjectInfo, referenced map[string]bool, cutoff time.Time) {
+	for _, object := range objects {
+		report.Scanned++
+		switch {
+		case referenced[object.Key]:
+			report.Referenced++
+		case object.Updated.After(cutoff):
+			report.Recent++
+		default:
+			report.Orphans = append(report.Orphans, Orphan{Key: object.Key, Size: object.Size, Updated: object.Updated})
+		}
+	}
+}
+
+// recheck looks at orphaned content again once its record is dropped, and
+// reports whether it may be deleted. An upload that missed the record may
+// have stored the contents again since the listing; such a copy is new and
+// must stay.
+func recheck(ctx context.Context, report *Report, key string, cutoff time.Time) bool {
+	info, err := config.Storage.Stat(ctx, key)
+	if errors.Is(err, storage.ErrNotExist) {
+		return false
+	}
+	if err != nil {
+		log.Printf("gc: failed to check %s: %v", key, err)
+		report.Failed++
+		return false
+	}
+	if info.Updated.After(cutoff) {
+		report.Recent++
+		return false
+	}
+	return true
+}
+
+// listCollectable lists the objects this service writes: content-addressed
+// files, upload chunks, peaks and the <uuid>/<name> files of older uploads.
+// Anything else in the bucket is left alone.
+func listCollectable(ctx context.Context) ([]storage.ObjectInfo, error) {
+	objects := []storage.ObjectInfo{}
+	for _, prefix := range []string{contentPrefix, uploadsPrefix, peaksPrefix} {
+		listed, err := config.Storage.List(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, listed...)
+	}
+	// Legacy keys start with a UUID, so only the hex digits need listing
+	for _, digit := range "0123456789abcdef" {
+		listed, err := config.Storage.List(ctx, string(digit))
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range listed {
+			if legacyKey.MatchString(object.Key) {
+				objects = append(objects, object)
+			}
+		}
+	}
+	return objects, nil
+}
+
+// expireUploads gives up on resumable uploads past their expiry, and on
+// assemblies that never finished, so their chunks become unreferenced
+func expireUploads(ctx context.Context, now time.Time, dryRun bool) (int, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"status": mongo.UploadOpen, "expiresAt": bson.M{"$lt": now.Unix()}},
+		bson.M{"status": mongo.UploadCompleting, "updatedAt": bson.M{"$lt": now.Add(-stuckAssembly).Unix()}},
+	}}
+	if dryRun {
+		count, err := config.UploadCollection.CountDocuments(ctx, filter)
+		return int(count), err
+	}
+	update := bson.M{"$set": bson.M{"status": mongo.UploadAborted, "updatedAt": now.Unix()}}
+	result, err := config.UploadCollection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.ModifiedCount), nil
+}
+
+// referencedKeys collects every object key the database still refers to.
+// Expired uploads do not count, even in a dry run that left them open.
+func referencedKeys(ctx context.Context, now time.Time) (map[string]bool, error) {
+	keys := map[string]bool{}
+	unresolved := 0
+
+	projection := bson.M{"versions": 1, "branches.versions": 1, "releases.assets": 1}
+	cursor, err := config.RepoCollection.Find(ctx, bson.M{}, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repos: %v", err)
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var repo mongo.Repo
+		if err := cursor.Decode(&repo); err != nil {
+			return nil, fmt.Errorf("failed to read repos: %v", err)
+		}
+		unresolved += addRepoKeys(keys, &repo)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read repos: %v", err)
+	}
+	// Their files could be anywhere in the store, so nothing is safe to delete
+	if unresolved > 0 {
+		return nil, fmt.Errorf("%d stored files are only known by a URL no object key can be read from", unresolved)
+	}
+
+	live := bson.M{"$or": bson.A{
+		bson.M{"status": mongo.UploadOpen, "expiresAt": bson.M{"$gte": now.Unix()}},
+		bson.M{"status": mongo.UploadCompleting, "updatedAt": bson.M{"$gte": now.Add(-stuckAssembly).Unix()}},
+	}}
+	uploads, err := config.UploadCollection.Find(ctx, live)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read uploads: %v", err)
+	}
+	defer uploads.Close(ctx)
+	for uploads.Next(ctx) {
+		var session mongo.UploadSession
+		if err := uploads.Decode(&session); err != nil {
+			return nil, fmt.Errorf("failed to read uploads: %v", err)
+		}
+		addUploadKeys(keys, &session)
+	}
+	if err := uploads.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read uploads: %v", err)
+	}
+
+	delete(keys, "")
+	return keys, nil
+}
+
+// addRepoKeys marks the objects of every version and release of repo and
+// returns how many entries only have a URL no object key can be read from
+func addRepoKeys(keys map[string]bool, repo *mongo.Repo) int {
+	unresolved := addVersionKeys(keys, repo.Versions)
+	for _, branch := range repo.Branches {
+		unresolved += addVersionKeys(keys, branch.Versions)
+	}
+	for _, release := range repo.Releases {
+		for _, asset := range release.Assets {
+			if !addStoredKey(keys, asset.ObjectKey, asset.URL) {
+				unresolved++
+			}
+		}
+	}
+	return unresolved
+}
+
+// addUploadKeys marks the chunks of a resumable upload and the stored
+// contents its files reuse
+func addUploadKeys(keys map[string]bool, session *mongo.UploadSession) {
+	for _, file := range session.Files {
+		keys[file.ObjectKey] = true
+		for _, part := range file.Parts {
+			keys[part.ObjectKey] = true
+		}
+	}
+}
+
+// addVersionKeys marks the objects of versions and returns how many
+// versions only have a URL no object key can be read from
+func addVersionKeys(keys map[string]bool, versions []mongo.Version) int {
+	unresolved := 0
+	for _, v := range versions {
+		if !addStoredKey(keys, v.ObjectKey, v.URL) {
+			unresolved++
+		}
+		for _, asset := range v.Assets {
+			keys[asset.ObjectKey] = true
+			if asset.Audio != nil {
+				keys[asset.Audio.PeaksKey] = true
+			}
+		}
+	}
+	return unresolved
+}
+
+// addStoredKey marks the object of an entry, reading the key from a URL left
+// over from before objects became private when it has none. It reports false
+// when the entry has a URL but no key can be read from it.
+func addStoredKey(keys map[string]bool, objectKey, storedURL string) bool {
+	if objectKey == "" && storedURL != "" {
+		objectKey = config.ObjectKeyFromURL(storedURL)
+		if objectKey == "" {
+			return false
+		}
+	}
+	keys[objectKey] = true
+	return true
+}
+
+// forgetContent drops the record of unreferenced content so it is no longer
+// offered for reuse. It reports false, keeping the object, when a repo
+// references the content or an upload reused it within the grace period.
+func forgetContent(ctx context.Context, key string, cutoff time.Time) (bool, error) {
+	filter := bson.M{"objectKey": key, "refs": 0, "releasedAt": bson.M{"$lt": cutoff.Unix()}}
+	result, err := config.ObjectCollection.DeleteOne(ctx, filter)
+	if err != nil {
+		return false, err
+	}
+	if result.DeletedCount == 1 {
+		return true, nil
+	}
+	// Content written without a record was never offered for reuse
+	count, err := config.ObjectCollection.CountDocuments(ctx, bson.M{"objectKey": key})
+	return count == 0, err
+}
+
+// Schedule runs a collection every interval until ctx is done
+func Schedule(ctx context.Context, interval time.Duration, opts Options) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := Run(ctx, opts)
+			if err != nil {
+				log.Printf("gc: %v", err)
+				continue
+			}
+			log.Printf("gc: scanned %d objects, deleted %d (%d bytes), %d failed",
+				report.Scanned, report.Deleted, report.BytesFreed, report.Failed)
+		}
+	}
+}
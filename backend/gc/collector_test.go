@@ -0,0 +1,224 @@
+package gc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"prodhub-backend/config"
+	"prodhub-backend/models/mongo"
+	"prodhub-backend/storage"
+)
+
+// fakeStore keeps object metadata in memory. Only listing and stat are used
+// by the collector's checks.
+type fakeStore struct {
+	objects map[string]storage.ObjectInfo
+	statErr error
+}
+
+func (s *fakeStore) Put(ctx context.Context, key string, r io.Reader, contentType string) (int64, error) {
+	return 0, errors.New("not implemented")
+}
+
+func (s *fakeStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *fakeStore) Delete(ctx context.Context, key string) error {
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *fakeStore) Stat(ctx context.Context, key string) (*storage.ObjectInfo, error) {
+	if s.statErr != nil {
+		return nil, s.statErr
+	}
+	info, ok := s.objects[key]
+	if !ok {
+		return nil, storage.ErrNotExist
+	}
+	return &info, nil
+}
+
+func (s *fakeStore) List(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
+	listed := []storage.ObjectInfo{}
+	for key, info := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			listed = append(listed, info)
+		}
+	}
+	sort.Slice(listed, func(i, j int) bool { return listed[i].Key < listed[j].Key })
+	return listed, nil
+}
+
+func (s *fakeStore) SignedURL(ctx context.Context, key, fileName string, expiry time.Duration) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+// useStore installs a fakeStore holding keys, last written at the given
+// times, as the configured storage for the rest of the test
+func useStore(t *testing.T, keys map[string]time.Time) *fakeStore {
+	t.Helper()
+	store := &fakeStore{objects: map[string]storage.ObjectInfo{}}
+	for key, updated := range keys {
+		store.objects[key] = storage.ObjectInfo{Key: key, Size: 10, Updated: updated}
+	}
+	previous := config.Storage
+	config.Storage = store
+	t.Cleanup(func() { config.Storage = previous })
+	return store
+}
+
+const legacy = "0f8fad5b-d9cb-469f-a165-70867728950e/beat.flp"
+
+func TestListCollectable(t *testing.T) {
+	now := time.Now()
+	useStore(t, map[string]time.Time{
+		"objects/sha256/ab12": now,
+		"uploads/u1/f1/0":     now,
+		"peaks/a1.json":       now,
+		legacy:                now,
+
+		// Left alone: not a UUID, nested below one, or written by others
+		"0f8fad5b/beat.flp":                            now,
+		"0f8fad5b-d9cb-469f-a165-70867728950e/a/b.wav": now,
+		"backups/db.gz":                                now,
+		"favicon.ico":                                  now,
+	})
+
+	objects, err := listCollectable(context.Background())
+	if err != nil {
+		t.Fatalf("listCollectable failed: %v", err)
+	}
+	got := []string{}
+	for _, object := range objects {
+		got = append(got, object.Key)
+	}
+	sort.Strings(got)
+	want := []string{legacy, "objects/sha256/ab12", "peaks/a1.json", "uploads/u1/f1/0"}
+	if !slices.Equal(got, want) {
+		t.Errorf("listCollectable() = %v, want %v", got, want)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	now := time.Now()
+	grace := 24 * time.Hour
+	cutoff := now.Add(-grace)
+	objects := []storage.ObjectInfo{
+		{Key: "objects/sha256/used", Updated: now.Add(-48 * time.Hour)},
+		{Key: "objects/sha256/young", Updated: now.Add(-time.Hour)},
+		{Key: "objects/sha256/old", Size: 7, Updated: now.Add(-48 * time.Hour)},
+		{Key: "uploads/u1/f1/0", Updated: cutoff}, // Exactly at the cutoff is past the grace period
+	}
+	referenced := map[string]bool{"objects/sha256/used": true}
+
+	report := &Report{}
+	classify(report, objects, referenced, cutoff)
+
+	if report.Scanned != 4 || report.Referenced != 1 || report.Recent != 1 {
+		t.Errorf("scanned %d, referenced %d, recent %d, want 4, 1, 1", report.Scanned, report.Referenced, report.Recent)
+	}
+	orphans := []string{}
+	for _, orphan := range report.Orphans {
+		orphans = append(orphans, orphan.Key)
+	}
+	if want := []string{"objects/sha256/old", "uploads/u1/f1/0"}; !slices.Equal(orphans, want) {
+		t.Errorf("orphans = %v, want %v", orphans, want)
+	}
+	if report.Orphans[0].Size != 7 {
+		t.Errorf("orphan size = %d, want 7", report.Orphans[0].Size)
+	}
+}
+
+func TestRecheck(t *testing.T) {
+	now := time.Now()
+	cutoff := now.Add(-24 * time.Hour)
+	tests := []struct {
+		name       string
+		objects    map[string]time.Time
+		statErr    error
+		want       bool
+		wantRecent int
+		wantFailed int
+	}{
+		{"still old", map[string]time.Time{"objects/sha256/k": now.Add(-48 * time.Hour)}, nil, true, 0, 0},
+		{"stored again since the listing", map[string]time.Time{"objects/sha256/k": now}, nil, false, 1, 0},
+		{"already gone", map[string]time.Time{}, nil, false, 0, 0},
+		{"store unavailable", map[string]time.Time{}, errors.New("timeout"), false, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := useStore(t, tt.objects)
+			store.statErr = tt.statErr
+
+			report := &Report{}
+			if got := recheck(context.Background(), report, "objects/sha256/k", cutoff); got != tt.want {
+				t.Errorf("recheck() = %v, want %v", got, tt.want)
+			}
+			if report.Recent != tt.wantRecent || report.Failed != tt.wantFailed {
+				t.Errorf("recent %d, failed %d, want %d, %d", report.Recent, report.Failed, tt.wantRecent, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestAddRepoKeys(t *testing.T) {
+	previous := config.BucketName
+	config.BucketName = "bucket"
+	t.Cleanup(func() { config.BucketName = previous })
+
+	repo := &mongo.Repo{
+		Versions: []mongo.Version{
+			{ObjectKey: "objects/sha256/v1"},
+			{URL: "https://storage.googleapis.com/bucket/" + legacy},
+		},
+		Branches: []mongo.Branch{{
+			Versions: []mongo.Version{{
+				ObjectKey: "objects/sha256/v2",
+				Assets: []mongo.Asset{
+					{ObjectKey: "objects/sha256/stem", Audio: &mongo.AudioInfo{PeaksKey: "peaks/stem.json"}},
+				},
+			}},
+		}},
+		Releases: []mongo.Release{{
+			Assets: []mongo.ReleaseAsset{{ObjectKey: "objects/sha256/master"}},
+		}},
+	}
+
+	keys := map[string]bool{}
+	if unresolved := addRepoKeys(keys, repo); unresolved != 0 {
+		t.Errorf("addRepoKeys() = %d unresolved, want 0", unresolved)
+	}
+	for _, key := range []string{"objects/sha256/v1", legacy, "objects/sha256/v2", "objects/sha256/stem", "peaks/stem.json", "objects/sha256/master"} {
+		if !keys[key] {
+			t.Errorf("%s is not referenced", key)
+		}
+	}
+
+	// A URL of another bucket says nothing about which object is in use
+	repo.Releases[0].Assets = append(repo.Releases[0].Assets, mongo.ReleaseAsset{URL: "https://example.com/master.wav"})
+	if unresolved := addRepoKeys(map[string]bool{}, repo); unresolved != 1 {
+		t.Errorf("addRepoKeys() = %d unresolved, want 1", unresolved)
+	}
+}
+
+func TestAddUploadKeys(t *testing.T) {
+	session := &mongo.UploadSession{Files: []mongo.UploadFile{
+		{ObjectKey: "objects/sha256/reused"},
+		{Parts: []mongo.UploadPart{{ObjectKey: "uploads/u1/f2/0"}, {ObjectKey: "uploads/u1/f2/1"}}},
+	}}
+	keys := map[string]bool{}
+	addUploadKeys(keys, session)
+	for _, key := range []string{"objects/sha256/reused", "uploads/u1/f2/0", "uploads/u1/f2/1"} {
+		if !keys[key] {
+			t.Errorf("%s is not referenced", key)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package helpers
+
+import "prodhub-backend/models/mongo"
+
+// Access is what a user may do with a repository. Each level includes the ones below it.
+type Access int
+
+const (
+	AccessNone       Access = iota // the repository is hidden from the user
+	AccessRead                     // view and download
+	AccessContribute               // upload versions and create branches
+	AccessMaintain                 // delete branches, tag, merge, manage collaborators and settings
+	AccessOwner                    // delete or transfer the repository
+)
+
+// roleAccess maps collaborator roles to access levels
+var roleAccess = map[string]Access{
+	mongo.RoleViewer:      AccessRead,
+	mongo.RoleContributor: AccessContribute,
+	mongo.RoleMaintainer:  AccessMaintain,
+	mongo.RoleOwner:       AccessOwner,
+}
+
+// FindCollaborator returns the collaborator entry of userID, or nil
+func FindCollaborator(collaborators []mongo.Collaborator, userID string) *mongo.Collaborator {
+	for i := range collaborators {
+		if collaborators[i].UserID == userID {
+			return &collaborators[i]
+		}
+	}
+	return nil
+}
+
+// RepoRole returns the role userID has on repo, or "" for strangers
+func RepoRole(repo *mongo.Repo, userID string) string {
+	if userID == "" {
+		return ""
+	}
+	if repo.OwnerId == userID {
+		return mongo.RoleOwner
+	}
+	if collaborator := FindCollaborator(repo.Collaborators, userID); collaborator != nil {
+		return collaborator.Role
+	}
+	return ""
+}
+
+// RepoAccess returns the access userID has to repo
+func RepoAccess(repo *mongo.Repo, userID string) Access {
+	access := roleAccess[RepoRole(repo, userID)]
+	if access < AccessRead && repo.Public {
+		return AccessRead
+	}
+	return access
+}
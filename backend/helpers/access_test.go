@@ -0,0 +1,43 @@
+package helpers
+
+import (
+	"testing"
+
+	"prodhub-backend/models/mongo"
+)
+
+func TestRepoAccess(t *testing.T) {
+	collaborators := []mongo.Collaborator{
+		{UserID: "viewer", Role: mongo.RoleViewer},
+		{UserID: "contributor", Role: mongo.RoleContributor},
+		{UserID: "maintainer", Role: mongo.RoleMaintainer},
+	}
+
+	tests := []struct {
+		name   string
+		public bool
+		userID string
+		want   Access
+	}{
+		{"owner of private repo", false, "owner", AccessOwner},
+		{"viewer of private repo", false, "viewer", AccessRead},
+		{"contributor of private repo", false, "contributor", AccessContribute},
+		{"maintainer of private repo", false, "maintainer", AccessMaintain},
+		{"stranger on private repo", false, "stranger", AccessNone},
+		{"anonymous on private repo", false, "", AccessNone},
+		{"owner of public repo", true, "owner", AccessOwner},
+		{"viewer of public repo", true, "viewer", AccessRead},
+		{"contributor of public repo", true, "contributor", AccessContribute},
+		{"maintainer of public repo", true, "maintainer", AccessMaintain},
+		{"stranger on public repo", true, "stranger", AccessRead},
+		{"anonymous on public repo", true, "", AccessRead},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mongo.Repo{OwnerId: "owner", Collaborators: collaborators, Public: tt.public}
+			if got := RepoAccess(repo, tt.userID); got != tt.want {
+				t.Errorf("RepoAccess(%q) = %d, want %d", tt.userID, got, tt.want)
+			}
+		})
+	}
+}
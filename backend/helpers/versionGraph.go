@@ -0,0 +1,158 @@
+package helpers
+
+import (
+	"sort"
+
+	"prodhub-backend/models/mongo"
+)
+
+// VersionGraph is the parent graph of every version in a repository. Branches
+// share the versions they were created from, so each version appears once.
+type VersionGraph struct {
+	versions map[string]mongo.Version
+}
+
+// NewVersionGraph indexes the versions of repo and all of its branches
+func NewVersionGraph(repo *mongo.Repo) *VersionGraph {
+	g := &VersionGraph{versions: map[string]mongo.Version{}}
+	for _, v := range repo.Versions {
+		g.versions[v.VersionID] = v
+	}
+	for _, branch := range repo.Branches {
+		for _, v := range branch.Versions {
+			g.versions[v.VersionID] = v
+		}
+	}
+	return g
+}
+
+// Add puts versions from outside the repository, such as a fork, into the graph
+func (g *VersionGraph) Add(versions ...mongo.Version) {
+	for _, v := range versions {
+		if _, ok := g.versions[v.VersionID]; !ok {
+			g.versions[v.VersionID] = v
+		}
+	}
+}
+
+// Get returns the version with the given ID
+func (g *VersionGraph) Get(versionID string) (mongo.Version, bool) {
+	v, ok := g.versions[versionID]
+	return v, ok
+}
+
+// Versions returns every version, oldest first
+func (g *VersionGraph) Versions() []mongo.Version {
+	list := make([]mongo.Version, 0, len(g.versions))
+	for _, v := range g.versions {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreatedAt != list[j].CreatedAt {
+			return list[i].CreatedAt < list[j].CreatedAt
+		}
+		return list[i].VersionID < list[j].VersionID
+	})
+	return list
+}
+
+// Ancestors returns the ancestors of a version, nearest first, not including
+// the version itself. Parents missing from the graph are skipped.
+func (g *VersionGraph) Ancestors(versionID string) []mongo.Version {
+	ancestors := []mongo.Version{}
+	seen := map[string]bool{versionID: true}
+	queue := []string{versionID}
+	for len(queue) > 0 {
+		v, ok := g.versions[queue[0]]
+		queue = queue[1:]
+		if !ok {
+			continue
+		}
+		for _, parentID := range v.ParentIDs {
+			if seen[parentID] {
+				continue
+			}
+			seen[parentID] = true
+			if parent, ok := g.versions[parentID]; ok {
+				ancestors = append(ancestors, parent)
+				queue = append(queue, parentID)
+			}
+		}
+	}
+	return ancestors
+}
+
+// IsAncestor reports whether ancestorID is versionID or one of its ancestors
+func (g *VersionGraph) IsAncestor(ancestorID, versionID string) bool {
+	if ancestorID == versionID {
+		return true
+	}
+	for _, v := range g.Ancestors(versionID) {
+		if v.VersionID == ancestorID {
+			return true
+		}
+	}
+	return false
+}
+
+// CommonAncestor returns the most recent version both a and b descend from,
+// counting a and b themselves
+func (g *VersionGraph) CommonAncestor(a, b string) (mongo.Version, bool) {
+	inA := map[string]bool{a: true}
+	for _, v := range g.Ancestors(a) {
+		inA[v.VersionID] = true
+	}
+
+	// Walk up from b, stopping each path at the first version a also has
+	var candidates []mongo.Version
+	seen := map[string]bool{b: true}
+	queue := []string{b}
+	for len(queue) > 0 {
+		v, ok := g.versions[queue[0]]
+		queue = queue[1:]
+		if !ok {
+			continue
+		}
+		if inA[v.VersionID] {
+			candidates = append(candidates, v)
+			continue
+		}
+		for _, parentID := range v.ParentIDs {
+			if !seen[parentID] {
+				seen[parentID] = true
+				queue = append(queue, parentID)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return mongo.Version{}, false
+	}
+
+	// Paths of different length can stop at versions that descend from one
+	// another; drop every candidate that is an ancestor of another one
+	older := map[string]bool{}
+	for _, c := range candidates {
+		queue = append(queue, c.ParentIDs...)
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if older[id] {
+			continue
+		}
+		older[id] = true
+		if v, ok := g.versions[id]; ok {
+			queue = append(queue, v.ParentIDs...)
+		}
+	}
+
+	// Newest first on ties
+	best := candidates[0]
+	bestIsBase := false
+	for _, c := range candidates {
+		if !older[c.VersionID] && (!bestIsBase || c.CreatedAt > best.CreatedAt) {
+			best, bestIsBase = c, true
+		}
+	}
+	return best, true
+}
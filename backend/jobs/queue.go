@@ -0,0 +1,69 @@
+// Package jobs runs slow work, such as audio analysis, off the request path.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// ErrQueueFull is returned when a job cannot be queued
+var ErrQueueFull = errors.New("job queue is full")
+
+// Timeout bounds a single job
+const Timeout = 10 * time.Minute
+
+// Job is a named unit of background work
+type Job struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+var queue chan Job
+
+// Start launches the workers. Jobs enqueued before Start are rejected.
+func Start(workers, size int) {
+	queue = make(chan Job, size)
+	for i := 0; i < workers; i++ {
+		go work()
+	}
+}
+
+// Enqueue adds a job without blocking the caller
+func Enqueue(job Job) error {
+	if queue == nil {
+		return ErrQueueFull
+	}
+	select {
+	case queue <- job:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func work() {
+	for job := range queue {
+		run(job)
+	}
+}
+
+func run(job Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+
+	// A panicking job must not take the worker down with it
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Job %s panicked: %v", job.Name, r)
+		}
+	}()
+
+	start := time.Now()
+	if err := job.Run(ctx); err != nil {
+		log.Printf("Job %s failed: %v", job.Name, err)
+		return
+	}
+	log.Printf("Job %s done in %s", job.Name, time.Since(start).Round(time.Millisecond))
+}
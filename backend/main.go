@@ -1,15 +1,33 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
+	"os"
 	"prodhub-backend/config"
+	controllers "prodhub-backend/controller"
+	"prodhub-backend/gc"
+	"prodhub-backend/jobs"
 	"prodhub-backend/routes"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	// "gc" runs one garbage collection and exits instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "gc" {
+		runGC(os.Args[2:])
+		return
+	}
+	// "revoke-public" closes the bucket to the public URLs of old uploads
+	if len(os.Args) > 1 && os.Args[1] == "revoke-public" {
+		runRevokePublic()
+		return
+	}
+
 	// INITIALIZE GIN
 	router := gin.Default()
 
@@ -17,30 +35,125 @@ func main() {
     router.Use(cors.New(cors.Config{
         AllowOrigins:     []string{"http://localhost:3000"},
         AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-        AllowHeaders:     []string{"Origin", "Content-Type", "Accept","Authorization"},
+        AllowHeaders:     []string{"Origin", "Content-Type", "Accept","Authorization","X-Chunk-Checksum"},
         AllowCredentials: true,
     }))
 
-	//CONNECTING FIREBASE
-	log.Println("Connecting to firebase")
-	if err := config.InitFirebase(); err != nil {
-        log.Fatalf("Failed to initialize Firebase: %v", err)
+	//CONNECTING STORAGE
+	if err := config.InitStorage(); err != nil {
+        log.Fatalf("Failed to initialize storage: %v", err)
     }
 
 	// // CONNECTING MONGODB
 	log.Println("Connecting to mongodb")
 	config.ConnectMongo()
+	if err := config.MigrateCollaborators(); err != nil {
+		log.Printf("Failed to migrate collaborators: %v", err)
+	}
+	if err := config.MigrateDefaultBranch(); err != nil {
+		log.Printf("Failed to mark default branches: %v", err)
+	}
+	if err := config.EnsureIndexes(); err != nil {
+		log.Printf("Failed to create indexes: %v", err)
+	}
+	if err := config.MigrateStoredURLs(); err != nil {
+		log.Printf("Failed to remove stored file URLs: %v", err)
+	}
+	if err := config.MigrateCamelot(); err != nil {
+		log.Printf("Failed to fill in Camelot codes: %v", err)
+	}
+
+	// START BACKGROUND JOBS
+	jobs.Start(2, 256)
+	go controllers.ResumeAudioAnalysis(10 * time.Minute)
+	if interval := durationEnv("GC_INTERVAL", 24*time.Hour); interval > 0 {
+		opts := gc.Options{Grace: durationEnv("GC_GRACE", 24*time.Hour)}
+		go gc.Schedule(context.Background(), interval, opts)
+	}
 
 	// CONNECTING POSTGRES
 	log.Println("Connecting to postgres")
 	config.ConnectPostgres()
+	if err := config.MigrateLikes(); err != nil {
+		log.Printf("Failed to migrate like counts: %v", err)
+	}
 
 	// Register Routes
 	routes.RepoRoutes(router)
 	routes.UserRoutes(router)
+	routes.StorageRoutes(router)
 
 	log.Println("Server is running on port 8080")
 	if err := router.Run(":8080"); err != nil {
 		log.Fatal("Failed to start server: ", err)
 	}
 }
+
+// runGC deletes, or with -dry-run lists, stored objects nothing refers to
+func runGC(args []string) {
+	flags := flag.NewFlagSet("gc", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only report unreferenced objects")
+	grace := flags.Duration("grace", 24*time.Hour, "keep unreferenced objects younger than this")
+	flags.Parse(args)
+
+	if err := config.InitStorage(); err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	config.ConnectMongo()
+	defer config.DisconnectMongo()
+
+	report, err := gc.Run(context.Background(), gc.Options{DryRun: *dryRun, Grace: *grace})
+	if err != nil {
+		log.Fatalf("Garbage collection failed: %v", err)
+	}
+
+	var orphanBytes int64
+	for _, orphan := range report.Orphans {
+		orphanBytes += orphan.Size
+		log.Printf("unreferenced: %s (%d bytes, updated %s)", orphan.Key, orphan.Size, orphan.Updated.Format(time.RFC3339))
+	}
+	log.Printf("Scanned %d objects: %d referenced, %d inside the grace period, %d unreferenced (%d bytes)",
+		report.Scanned, report.Referenced, report.Recent, len(report.Orphans), orphanBytes)
+	log.Printf("Resumable uploads past expiry: %d", report.ExpiredUploads)
+	if *dryRun {
+		log.Println("Dry run, nothing was deleted")
+		return
+	}
+	log.Printf("Deleted %d objects (%d bytes), kept %d still counted as used, %d failed",
+		report.Deleted, report.BytesFreed, report.Counted, report.Failed)
+}
+
+// runRevokePublic removes public read access from the bucket and its
+// objects. It is run once, after upgrading from public file URLs.
+func runRevokePublic() {
+	if err := config.InitStorage(); err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	store, ok := config.Storage.(interface {
+		RevokePublicAccess(ctx context.Context) (int, error)
+	})
+	if !ok {
+		log.Println("Storage driver has no public access to revoke")
+		return
+	}
+	revoked, err := store.RevokePublicAccess(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to revoke public access: %v", err)
+	}
+	log.Printf("Bucket closed to public access, removed public ACLs from %d objects", revoked)
+}
+
+// durationEnv reads a duration such as "12h" from the environment. "0"
+// turns the feature it controls off.
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %s", name, value, fallback)
+		return fallback
+	}
+	return d
+}
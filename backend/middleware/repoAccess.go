@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"prodhub-backend/config"
+	"prodhub-backend/helpers"
+	"prodhub-backend/models/mongo"
+)
+
+// loadRepo fetches a repository by ID; tests replace it to avoid a database
+var loadRepo = func(ctx context.Context, repoID string) (mongo.Repo, error) {
+	var repo mongo.Repo
+	err := config.RepoCollection.FindOne(ctx, bson.M{"repoId": repoID}).Decode(&repo)
+	return repo, err
+}
+
+// RequireRepoAccess loads the repository named by the :id route parameter and
+// aborts unless the authenticated user has at least the required access.
+// Repositories the user cannot read answer 404 so private repos stay hidden;
+// readable repositories the user may not change answer 403.
+// The loaded repo and access level are stored as "repo" and "repoAccess".
+func RequireRepoAccess(required helpers.Access) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		userID, _ := c.Get("userID")
+		uid, _ := userID.(string)
+
+		repo, err := loadRepo(ctx, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "repository not found"})
+			c.Abort()
+			return
+		}
+
+		access := helpers.RepoAccess(&repo, uid)
+		if access < helpers.AccessRead {
+			c.JSON(http.StatusNotFound, gin.H{"error": "repository not found"})
+			c.Abort()
+			return
+		}
+		if access < required {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			c.Abort()
+			return
+		}
+
+		c.Set("repo", repo)
+		c.Set("repoAccess", access)
+		c.Next()
+	}
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	mongodriver "go.mongodb.org/mongo-driver/mongo"
+	"prodhub-backend/helpers"
+	"prodhub-backend/models/mongo"
+)
+
+// newTestRouter mounts the repo routes' access checks in front of handlers
+// that always succeed. The X-User header stands in for authentication.
+func newTestRouter(repos map[string]mongo.Repo) *gin.Engine {
+	loadRepo = func(ctx context.Context, repoID string) (mongo.Repo, error) {
+		repo, ok := repos[repoID]
+		if !ok {
+			return mongo.Repo{}, mongodriver.ErrNoDocuments
+		}
+		return repo, nil
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if userID := c.GetHeader("X-User"); userID != "" {
+			c.Set("userID", userID)
+		}
+	})
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	repo := router.Group("/repo")
+	repo.GET("/:id", RequireRepoAccess(helpers.AccessRead), ok)
+	repo.PUT("/:id", RequireRepoAccess(helpers.AccessMaintain), ok)
+	repo.DELETE("/:id", RequireRepoAccess(helpers.AccessOwner), ok)
+	return router
+}
+
+func TestRequireRepoAccess(t *testing.T) {
+	collaborators := []mongo.Collaborator{
+		{UserID: "viewer", Role: mongo.RoleViewer},
+		{UserID: "contributor", Role: mongo.RoleContributor},
+		{UserID: "maintainer", Role: mongo.RoleMaintainer},
+	}
+	router := newTestRouter(map[string]mongo.Repo{
+		"1": {RepoID: "1", OwnerId: "owner", Collaborators: collaborators},
+		"2": {RepoID: "2", OwnerId: "owner", Collaborators: collaborators, Public: true},
+	})
+
+	tests := []struct {
+		method string
+		repoID string
+		userID string
+		want   int
+	}{
+		// A stranger cannot read, edit or delete a private repo, nor learn it exists
+		{http.MethodGet, "1", "stranger", http.StatusNotFound},
+		{http.MethodPut, "1", "stranger", http.StatusNotFound},
+		{http.MethodDelete, "1", "stranger", http.StatusNotFound},
+		{http.MethodGet, "1", "", http.StatusNotFound},
+		{http.MethodGet, "missing", "owner", http.StatusNotFound},
+
+		{http.MethodGet, "1", "viewer", http.StatusOK},
+		{http.MethodPut, "1", "viewer", http.StatusForbidden},
+		{http.MethodPut, "1", "contributor", http.StatusForbidden},
+		{http.MethodPut, "1", "maintainer", http.StatusOK},
+		{http.MethodDelete, "1", "maintainer", http.StatusForbidden},
+		{http.MethodDelete, "1", "viewer", http.StatusForbidden},
+		{http.MethodDelete, "1", "owner", http.StatusOK},
+
+		// Public repos can be read by anyone but changed only by members
+		{http.MethodGet, "2", "stranger", http.StatusOK},
+		{http.MethodPut, "2", "stranger", http.StatusForbidden},
+		{http.MethodDelete, "2", "stranger", http.StatusForbidden},
+		{http.MethodDelete, "2", "maintainer", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/repo/"+tt.repoID, nil)
+		if tt.userID != "" {
+			req.Header.Set("X-User", tt.userID)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s /repo/%s as %q = %d, want %d", tt.method, tt.repoID, tt.userID, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package mongo
+
+// Asset kinds
+const (
+	AssetProject = "project"
+	AssetMixdown = "mixdown"
+	AssetStem    = "stem"
+	AssetSample  = "sample"
+	AssetMIDI    = "midi"
+	AssetOther   = "other"
+)
+
+// Asset is one file of a version: the project itself, its mixdown, stems and so on
+type Asset struct {
+	AssetID     string `bson:"assetId"`
+	Name        string `bson:"name"`
+	Kind        string `bson:"kind"`
+	ContentType string `bson:"contentType"`
+	Size        int64  `bson:"size"`
+	Checksum    string `bson:"checksum"` // Hex SHA-256 of the content
+	ObjectKey   string `bson:"objectKey"`
+
+	Audio *AudioInfo `bson:"audio,omitempty"` // Set for audio files once they are queued for analysis
+}
+
+// Audio analysis states
+const (
+	AudioPending     = "pending"
+	AudioReady       = "ready"
+	AudioFailed      = "failed"
+	AudioUnsupported = "unsupported"
+)
+
+// AudioInfo is what the background analysis learned about an audio asset
+type AudioInfo struct {
+	Status     string  `bson:"status"`
+	Error      string  `bson:"error,omitempty"`
+	Duration   float64 `bson:"duration"` // Seconds
+	SampleRate int     `bson:"sampleRate"`
+	Channels   int     `bson:"channels"`
+	PeaksKey   string  `bson:"peaksKey,omitempty"` // Storage key of the waveform peaks JSON
+}
+
+// Loudness is the level analysis of a version's mixdown
+type Loudness struct {
+	AssetID      string  `bson:"assetId"`      // Mixdown that was measured
+	Integrated   float64 `bson:"integrated"`   // LUFS
+	ShortTermMax float64 `bson:"shortTermMax"` // LUFS
+	Range        float64 `bson:"range"`        // LU
+	SamplePeak   float64 `bson:"samplePeak"`   // dBFS
+	TruePeak     float64 `bson:"truePeak"`     // dBTP
+	RMS          float64 `bson:"rms"`          // dBFS
+}
+
+// MusicAnalysis is the tempo and key heard in a version's mixdown
+type MusicAnalysis struct {
+	AssetID       string  `bson:"assetId"` // Mixdown that was analysed
+	BPM           float64 `bson:"bpm"`
+	BPMConfidence float64 `bson:"bpmConfidence"` // 0 to 1
+	Key           string  `bson:"key"`           // Like "A minor"
+	Camelot       string  `bson:"camelot"`       // Like "8A"
+	KeyConfidence float64 `bson:"keyConfidence"` // 0 to 1
+	BPMMismatch   bool    `bson:"bpmMismatch"`   // Confidently disagrees with the repo description
+	KeyMismatch   bool    `bson:"keyMismatch"`
+}
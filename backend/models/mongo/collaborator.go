@@ -0,0 +1,48 @@
+package mongo
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// Collaborator roles, from least to most privileged
+const (
+	RoleViewer      = "viewer"      // can view and download
+	RoleContributor = "contributor" // can upload versions and create branches
+	RoleMaintainer  = "maintainer"  // can delete branches, tag, merge and change settings
+	RoleOwner       = "owner"       // can delete or transfer the repository
+)
+
+// ValidRole reports whether role can be given to a collaborator. Ownership is
+// never granted through the collaborator list.
+func ValidRole(role string) bool {
+	return role == RoleViewer || role == RoleContributor || role == RoleMaintainer
+}
+
+// Collaborator is a user with a role on someone else's repository
+type Collaborator struct {
+	UserID  string `bson:"userId"`
+	Role    string `bson:"role"`
+	AddedAt int64  `bson:"addedAt"`
+}
+
+// UnmarshalBSONValue also accepts the plain user ID strings collaborators used
+// to be stored as, which become contributors
+func (c *Collaborator) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	if t == bsontype.String {
+		var userID string
+		if err := bson.UnmarshalValue(t, data, &userID); err != nil {
+			return err
+		}
+		*c = Collaborator{UserID: userID, Role: RoleContributor}
+		return nil
+	}
+
+	type plain Collaborator
+	var decoded plain
+	if err := bson.UnmarshalValue(t, data, &decoded); err != nil {
+		return err
+	}
+	*c = Collaborator(decoded)
+	return nil
+}
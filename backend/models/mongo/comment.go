@@ -0,0 +1,23 @@
+package mongo
+
+// MusicalPosition is a bar/beat position in the project, counted from 1
+type MusicalPosition struct {
+	Bar  int `bson:"bar"`
+	Beat int `bson:"beat"`
+	Tick int `bson:"tick"`
+}
+
+// VersionComment is feedback on a version, optionally anchored to a point in the track
+type VersionComment struct {
+	CommentID  string           `bson:"commentId"`
+	VersionID  string           `bson:"versionId"`
+	ParentID   string           `bson:"parentId,omitempty"` // Set on replies
+	AuthorID   string           `bson:"authorId"`
+	Body       string           `bson:"body"`
+	Timestamp  *float64         `bson:"timestamp,omitempty"` // Seconds into the track
+	Position   *MusicalPosition `bson:"position,omitempty"`
+	Resolved   bool             `bson:"resolved"`
+	ResolvedBy string           `bson:"resolvedBy,omitempty"`
+	ResolvedAt int64            `bson:"resolvedAt,omitempty"`
+	CreatedAt  int64            `bson:"createdAt"`
+}
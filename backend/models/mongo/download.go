@@ -0,0 +1,21 @@
+package mongo
+
+// Download methods
+const (
+	DownloadRedirect = "redirect" // Sent to a short-lived signed URL
+	DownloadStream   = "stream"   // Streamed through the API
+)
+
+// Download records one fetch of a stored file, for analytics
+type Download struct {
+	DownloadID string `bson:"downloadId"`
+	RepoID     string `bson:"repoId"`
+	VersionID  string `bson:"versionId,omitempty"`
+	ReleaseID  string `bson:"releaseId,omitempty"`
+	AssetID    string `bson:"assetId,omitempty"`
+	ObjectKey  string `bson:"objectKey"`
+	FileName   string `bson:"fileName"`
+	UserID     string `bson:"userId"`
+	Method     string `bson:"method"`
+	CreatedAt  int64  `bson:"createdAt"`
+}
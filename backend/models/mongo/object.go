@@ -0,0 +1,14 @@
+package mongo
+
+// StoredObject is a file kept once in object storage under the SHA-256 of its
+// contents, however many versions use it
+type StoredObject struct {
+	Checksum    string   `bson:"checksum"` // Hex SHA-256 of the contents
+	ObjectKey   string   `bson:"objectKey"`
+	Size        int64    `bson:"size"`
+	ContentType string   `bson:"contentType"`
+	Repos       []string `bson:"repos"` // Repos with a version or release using the object
+	Refs        int      `bson:"refs"`  // Length of Repos
+	CreatedAt   int64    `bson:"createdAt"`
+	ReleasedAt  int64    `bson:"releasedAt,omitempty"` // When it was last stored, reused or dropped by a repo
+}
@@ -1,10 +1,38 @@
 package mongo
 
+// ProjectChannel is a channel rack entry of an uploaded project
+type ProjectChannel struct {
+	Index      int    `bson:"index"`
+	Name       string `bson:"name"`
+	Type       string `bson:"type"`
+	Plugin     string `bson:"plugin,omitempty"`
+	SamplePath string `bson:"samplePath,omitempty"`
+}
+
+// ProjectInfo is the metadata read from an uploaded FL Studio project
+type ProjectInfo struct {
+	FLVersion    string           `bson:"flVersion"`
+	Tempo        float64          `bson:"tempo"`
+	TimeSigNum   int              `bson:"timeSigNum"`
+	TimeSigBeat  int              `bson:"timeSigBeat"`
+	Channels     []ProjectChannel `bson:"channels"`
+	Plugins      []string         `bson:"plugins"`
+	PatternCount int              `bson:"patternCount"`
+	Samples      []string         `bson:"samples"`
+}
+
 type Version struct {
-	VersionID string `bson:"versionId"`
-	URL       string `bson:"url"`
-	Changes   string `bson:"changes"`
-	CreatedAt int64  `bson:"createdAt"`
+	VersionID string         `bson:"versionId"`
+	URL       string         `bson:"url,omitempty"` // Public URL of uploads made before objects became private
+	ObjectKey string         `bson:"objectKey"`     // Key of the main file in object storage
+	Changes   string         `bson:"changes"`
+	CreatedAt int64          `bson:"createdAt"`
+	Project   *ProjectInfo   `bson:"project,omitempty"`  // Set when the upload is an FL Studio project
+	ParentIDs []string       `bson:"parentIds"`          // Versions this one was made from; two for merges
+	Branch    string         `bson:"branch"`             // Branch the version was made on
+	Assets    []Asset        `bson:"assets"`             // Every file uploaded with the version
+	Loudness  *Loudness      `bson:"loudness,omitempty"` // Levels of the mixdown, once analysed
+	Music     *MusicAnalysis `bson:"music,omitempty"`    // Tempo and key of the mixdown, once analysed
 }
 
 type Activity struct {
@@ -13,28 +41,127 @@ type Activity struct {
 }
 
 type Branch struct {
-	BranchID   string     `bson:"branchId"`
-	Name       string     `bson:"name"`       // Name of the branch
-	Versions   []Version  `bson:"versions"`   // Versions specific to this branch
-	Activities []Activity `bson:"activities"` // Activities specific to this branch
-	CreatedAt  int64      `bson:"createdAt"`  // Timestamp when branch was created
-	IsDefault  bool       `bson:"isDefault"`  // Indicates if this is the default branch
+	BranchID      string     `bson:"branchId"`
+	Name          string     `bson:"name"`          // Name of the branch
+	Versions      []Version  `bson:"versions"`      // Versions specific to this branch, oldest first
+	HeadVersionID string     `bson:"headVersionId"` // Latest version on this branch
+	Activities    []Activity `bson:"activities"`    // Activities specific to this branch
+	CreatedAt     int64      `bson:"createdAt"`     // Timestamp when branch was created
+	IsDefault     bool       `bson:"isDefault"`     // Indicates if this is the default branch
+}
+
+// Tag is an immutable name pointing at a version, e.g. "Final master"
+type Tag struct {
+	Name      string `bson:"name"`
+	VersionID string `bson:"versionId"`
+	Message   string `bson:"message"`
+	CreatedBy string `bson:"createdBy"`
+	CreatedAt int64  `bson:"createdAt"`
+}
+
+// ReleaseAsset is a deliverable attached to a release
+type ReleaseAsset struct {
+	Name      string `bson:"name"`
+	Kind      string `bson:"kind"` // mixdown, stem or other
+	ObjectKey string `bson:"objectKey"`
+	URL       string `bson:"url,omitempty"` // Public URL of uploads made before objects became private
+	Size      int64  `bson:"size"`
+}
+
+// Release groups a tag with release notes and deliverables
+type Release struct {
+	ReleaseID string         `bson:"releaseId"`
+	Tag       string         `bson:"tag"`
+	Title     string         `bson:"title"`
+	Notes     string         `bson:"notes"`
+	Assets    []ReleaseAsset `bson:"assets"`
+	CreatedBy string         `bson:"createdBy"`
+	CreatedAt int64          `bson:"createdAt"`
+	Pending   bool           `bson:"pending,omitempty"` // Deliverables are still uploading; hidden until published
+}
+
+// Invitation statuses
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+)
+
+// Invitation asks a user to become a collaborator on a repository
+type Invitation struct {
+	InvitationID string `bson:"invitationId"`
+	UserID       string `bson:"userId"` // Invited user
+	Username     string `bson:"username"`
+	Role         string `bson:"role"` // Role given on acceptance
+	InvitedBy    string `bson:"invitedBy"`
+	Status       string `bson:"status"`
+	CreatedAt    int64  `bson:"createdAt"`
+	RespondedAt  int64  `bson:"respondedAt"`
+}
+
+// OwnershipTransfer is a pending request to hand a repository to another user
+type OwnershipTransfer struct {
+	ToUserID           string `bson:"toUserId"`
+	ToUsername         string `bson:"toUsername"`
+	RequestedBy        string `bson:"requestedBy"`
+	KeepAsCollaborator bool   `bson:"keepAsCollaborator"` // Old owner stays on as a maintainer
+	CreatedAt          int64  `bson:"createdAt"`
+}
+
+// ForkSource records the repository a fork was made from
+type ForkSource struct {
+	RepoID   string `bson:"repoId"`
+	OwnerID  string `bson:"ownerId"`
+	Name     string `bson:"name"`
+	ForkedAt int64  `bson:"forkedAt"`
+}
+
+// RepoDescription holds the musical details of a repository
+type RepoDescription struct {
+	BPM            int    `bson:"bpm"`            // 0 until set by the user or read from a project
+	BPMFromProject bool   `bson:"bpmFromProject"` // BPM was filled in from an uploaded project
+	Scale          string `bson:"scale"`
+	Camelot        string `bson:"camelot"` // Camelot code of Scale for search, "" when Scale is no key
+	Genre          string `bson:"genre"`
+
+	Detected *MusicAnalysis `bson:"detected,omitempty"` // Tempo and key of the latest analysed mixdown
 }
 
 type Repo struct {
-	RepoID        string   `bson:"repoId"`
-	OwnerId       string   `bson:"ownerId"`
-	Collaborators []string `bson:"collaborators"`
-	Name          string   `bson:"name"`
-	Description   struct {
-		BPM   int    `bson:"bpm"`
-		Scale string `bson:"scale"`
-		Genre string `bson:"genre"`
-	} `bson:"description"`
-	Activity  []Activity `bson:"activity"` // General repository activities
-	Versions  []Version  `bson:"versions"` // General repository versions
-	Branches  []Branch   `bson:"branches"` // List of branches
-	CreatedAt int64      `bson:"createdAt"`
-	UpdatedAt int64      `bson:"updatedAt"`
-	Public     bool      `bson:"public"`
-}
\ No newline at end of file
+	RepoID        string             `bson:"repoId"`
+	OwnerId       string             `bson:"ownerId"`
+	Collaborators []Collaborator     `bson:"collaborators"`
+	Invitations   []Invitation       `bson:"invitations"`
+	Transfer      *OwnershipTransfer `bson:"pendingTransfer,omitempty"`
+	Name          string             `bson:"name"`
+	Description   RepoDescription    `bson:"description"`
+	Activity      []Activity         `bson:"activity"` // General repository activities
+	Versions      []Version          `bson:"versions"` // Versions uploaded before versions were recorded on branches
+	Branches      []Branch           `bson:"branches"` // List of branches
+	Tags          []Tag              `bson:"tags"`
+	Releases      []Release          `bson:"releases"`
+	Reviews       []ReviewRequest    `bson:"reviews"`
+	Comments      []VersionComment   `bson:"comments"`
+	CreatedAt     int64              `bson:"createdAt"`
+	UpdatedAt     int64              `bson:"updatedAt"`
+	Public        bool               `bson:"public"`
+	ForkedFrom    *ForkSource        `bson:"forkedFrom,omitempty"`
+	ForkCount     int                `bson:"forkCount"`
+	Forks         []string           `bson:"forks"` // Repo IDs of forks made from this repository
+	Likes         int                `bson:"likes"` // Users who liked the repository
+}
+
+// RepoSummary is the part of a repository shown in listings
+type RepoSummary struct {
+	RepoID        string          `bson:"repoId"`
+	OwnerId       string          `bson:"ownerId"`
+	Collaborators []Collaborator  `bson:"collaborators"`
+	Name          string          `bson:"name"`
+	Description   RepoDescription `bson:"description"`
+	CreatedAt     int64           `bson:"createdAt"`
+	UpdatedAt     int64           `bson:"updatedAt"`
+	Public        bool            `bson:"public"`
+	ForkedFrom    *ForkSource     `bson:"forkedFrom,omitempty"`
+	ForkCount     int             `bson:"forkCount"`
+	Likes         int             `bson:"likes"`
+}
@@ -0,0 +1,42 @@
+package mongo
+
+// Review request statuses
+const (
+	ReviewOpen   = "open"
+	ReviewMerged = "merged"
+	ReviewClosed = "closed"
+)
+
+// ReviewApproval is a reviewer signing off on a review request
+type ReviewApproval struct {
+	UserID     string `bson:"userId"`
+	VersionID  string `bson:"versionId"` // Source head at the time of approval
+	ApprovedAt int64  `bson:"approvedAt"`
+}
+
+// ReviewComment is a message in the discussion of a review request
+type ReviewComment struct {
+	CommentID string `bson:"commentId"`
+	AuthorID  string `bson:"authorId"`
+	Body      string `bson:"body"`
+	CreatedAt int64  `bson:"createdAt"`
+}
+
+// ReviewRequest proposes merging a branch, possibly from a fork, into a
+// branch of the repository it is stored on
+type ReviewRequest struct {
+	ReviewID        string           `bson:"reviewId"`
+	Title           string           `bson:"title"`
+	Description     string           `bson:"description"`
+	AuthorID        string           `bson:"authorId"`
+	SourceRepoID    string           `bson:"sourceRepoId"`
+	SourceBranch    string           `bson:"sourceBranch"`
+	TargetBranch    string           `bson:"targetBranch"`
+	Status          string           `bson:"status"`
+	Approvals       []ReviewApproval `bson:"approvals"`
+	Comments        []ReviewComment  `bson:"comments"`
+	MergedVersionID string           `bson:"mergedVersionId,omitempty"` // Target head after the merge
+	MergedBy        string           `bson:"mergedBy,omitempty"`
+	CreatedAt       int64            `bson:"createdAt"`
+	UpdatedAt       int64            `bson:"updatedAt"`
+}
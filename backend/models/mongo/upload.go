@@ -0,0 +1,46 @@
+package mongo
+
+// Upload session statuses
+const (
+	UploadOpen       = "open"
+	UploadCompleting = "completing" // Parts are being assembled
+	UploadCompleted  = "completed"
+	UploadAborted    = "aborted"
+)
+
+// UploadPart is one received chunk of a file, stored as its own object
+type UploadPart struct {
+	Offset    int64  `bson:"offset"`
+	Size      int64  `bson:"size"`
+	End       int64  `bson:"end"` // Offset + Size, so overlaps can be queried
+	ObjectKey string `bson:"objectKey"`
+	Checksum  string `bson:"checksum"` // Hex SHA-256 of the chunk
+}
+
+// UploadFile is a file announced when a resumable upload starts
+type UploadFile struct {
+	FileID    string       `bson:"fileId"`
+	Name      string       `bson:"name"`
+	Kind      string       `bson:"kind"`
+	Size      int64        `bson:"size"`
+	Checksum  string       `bson:"checksum"`            // Hex SHA-256 the assembled file must match
+	ObjectKey string       `bson:"objectKey,omitempty"` // Set when identical contents are already stored
+	Parts     []UploadPart `bson:"parts"`
+}
+
+// UploadSession is a resumable upload of the files of one version. Chunks can
+// arrive in any order and be retried; the version is only created once every
+// file is complete and matches its checksum.
+type UploadSession struct {
+	UploadID  string       `bson:"uploadId"`
+	RepoID    string       `bson:"repoId"`
+	Branch    string       `bson:"branch"`
+	UserID    string       `bson:"userId"`
+	Changes   string       `bson:"changes"`
+	Files     []UploadFile `bson:"files"`
+	Status    string       `bson:"status"`
+	VersionID string       `bson:"versionId,omitempty"` // Set once completed
+	CreatedAt int64        `bson:"createdAt"`
+	UpdatedAt int64        `bson:"updatedAt"`
+	ExpiresAt int64        `bson:"expiresAt"`
+}
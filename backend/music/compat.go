@@ -0,0 +1,105 @@
+package music
+
+import (
+	"fmt"
+	"math"
+)
+
+// KeyRelation is how two keys sit on the Camelot wheel
+type KeyRelation string
+
+const (
+	SameKey     KeyRelation = "same"     // Same wheel position
+	RelativeKey KeyRelation = "relative" // Same number, other ring: same notes
+	AdjacentKey KeyRelation = "adjacent" // One step round the wheel on the same ring
+	Clashing    KeyRelation = "none"
+)
+
+// keyScores rank key relations for harmonic mixing
+var keyScores = map[KeyRelation]float64{
+	SameKey:     1,
+	RelativeKey: 0.9,
+	AdjacentKey: 0.8,
+	Clashing:    0,
+}
+
+// Relate returns how key b mixes with key a
+func Relate(a, b Key) KeyRelation {
+	an, al := a.Camelot()
+	bn, bl := b.Camelot()
+	switch {
+	case an == bn && al == bl:
+		return SameKey
+	case an == bn:
+		return RelativeKey
+	case al == bl && (an%12+1 == bn || bn%12+1 == an):
+		return AdjacentKey
+	}
+	return Clashing
+}
+
+// MixableCamelot lists the Camelot codes of the keys Relate does not find
+// clashing with k: its own, its relative and its two neighbours on the wheel
+func MixableCamelot(k Key) []string {
+	n, letter := k.Camelot()
+	other := byte('B')
+	if letter == 'B' {
+		other = 'A'
+	}
+	return []string{
+		fmt.Sprintf("%d%c", n, letter),
+		fmt.Sprintf("%d%c", n, other),
+		fmt.Sprintf("%d%c", n%12+1, letter),
+		fmt.Sprintf("%d%c", (n+10)%12+1, letter),
+	}
+}
+
+// Score rates a key relation from 0, clashing, to 1, the same key
+func (r KeyRelation) Score() float64 {
+	return keyScores[r]
+}
+
+// TempoRelation is how a tempo lines up with another
+type TempoRelation string
+
+const (
+	SameTempo  TempoRelation = "same"
+	HalfTime   TempoRelation = "half"   // The other track runs at half the tempo
+	DoubleTime TempoRelation = "double" // The other track runs at twice the tempo
+	TempoApart TempoRelation = "none"
+)
+
+// halfDoublePenalty keeps half and double time matches just below straight ones
+const halfDoublePenalty = 0.9
+
+// MatchTempo compares a candidate tempo with a wanted one, allowing tolerance
+// BPM of difference after scaling for half and double time. It returns the
+// best relation, its score from 0 to 1, and the remaining difference in BPM.
+func MatchTempo(want, candidate, tolerance float64) (TempoRelation, float64, float64) {
+	best, bestScore, bestDiff := TempoApart, 0.0, math.Inf(1)
+	if want <= 0 || candidate <= 0 {
+		return best, bestScore, bestDiff
+	}
+	for _, option := range []struct {
+		relation TempoRelation
+		factor   float64
+		weight   float64
+	}{
+		{SameTempo, 1, 1},
+		{HalfTime, 2, halfDoublePenalty},
+		{DoubleTime, 0.5, halfDoublePenalty},
+	} {
+		diff := math.Abs(candidate*option.factor - want)
+		if diff > tolerance {
+			continue
+		}
+		score := option.weight
+		if tolerance > 0 {
+			score *= 1 - 0.5*diff/tolerance
+		}
+		if score > bestScore {
+			best, bestScore, bestDiff = option.relation, score, diff
+		}
+	}
+	return best, bestScore, bestDiff
+}
@@ -0,0 +1,116 @@
+package music
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func mustKey(t *testing.T, s string) Key {
+	t.Helper()
+	k, err := ParseKey(s)
+	if err != nil {
+		t.Fatalf("ParseKey(%q) failed: %v", s, err)
+	}
+	return k
+}
+
+func TestRelate(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want KeyRelation
+	}{
+		{"C major", "C major", SameKey},
+		{"C major", "8B", SameKey},
+		{"C major", "A minor", RelativeKey},
+		{"A minor", "C major", RelativeKey},
+		{"C major", "G major", AdjacentKey},
+		{"C major", "F major", AdjacentKey},
+		{"A minor", "E minor", AdjacentKey},
+		{"E major", "B major", AdjacentKey}, // 12B and 1B wrap round the wheel
+		{"B major", "E major", AdjacentKey},
+		{"C major", "E minor", Clashing}, // One step and the other ring
+		{"C major", "D major", Clashing}, // Two steps
+		{"C major", "F# major", Clashing},
+		{"A minor", "A major", Clashing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" with "+tt.b, func(t *testing.T) {
+			if got := Relate(mustKey(t, tt.a), mustKey(t, tt.b)); got != tt.want {
+				t.Errorf("Relate(%s, %s) = %s, want %s", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMixableCamelot(t *testing.T) {
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"C major", []string{"8B", "8A", "9B", "7B"}},
+		{"G# minor", []string{"1A", "1B", "2A", "12A"}},
+		{"E major", []string{"12B", "12A", "1B", "11B"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := MixableCamelot(mustKey(t, tt.key)); !slices.Equal(got, tt.want) {
+				t.Errorf("MixableCamelot(%s) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMixableCamelotMatchesRelate(t *testing.T) {
+	keys := []Key{}
+	for tonic := 0; tonic < 12; tonic++ {
+		keys = append(keys, Key{tonic, Major}, Key{tonic, Minor})
+	}
+	for _, a := range keys {
+		mixable := MixableCamelot(a)
+		for _, b := range keys {
+			listed := slices.Contains(mixable, b.CamelotCode())
+			if clashing := Relate(a, b) == Clashing; listed == clashing {
+				t.Errorf("%v and %v: listed %v, relation %s", a, b, listed, Relate(a, b))
+			}
+		}
+	}
+}
+
+func TestKeyRelationScore(t *testing.T) {
+	order := []KeyRelation{SameKey, RelativeKey, AdjacentKey, Clashing}
+	for i := 1; i < len(order); i++ {
+		if order[i-1].Score() <= order[i].Score() {
+			t.Errorf("%s scores %.2f, not above %s at %.2f", order[i-1], order[i-1].Score(), order[i], order[i].Score())
+		}
+	}
+	if SameKey.Score() != 1 || Clashing.Score() != 0 {
+		t.Errorf("scores run from %.2f to %.2f, want 1 to 0", SameKey.Score(), Clashing.Score())
+	}
+}
+
+func TestMatchTempo(t *testing.T) {
+	tests := []struct {
+		name                       string
+		want, candidate, tolerance float64
+		relation                   TempoRelation
+		score, diff                float64
+	}{
+		{"same", 140, 140, 2, SameTempo, 1, 0},
+		{"within tolerance", 140, 141, 2, SameTempo, 0.75, 1},
+		{"half time", 140, 70, 2, HalfTime, 0.9, 0},
+		{"double time", 70, 140, 2, DoubleTime, 0.9, 0},
+		{"exact only", 140, 140, 0, SameTempo, 1, 0},
+		{"too far", 140, 100, 2, TempoApart, 0, math.Inf(1)},
+		{"no tempo", 0, 140, 2, TempoApart, 0, math.Inf(1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			relation, score, diff := MatchTempo(tt.want, tt.candidate, tt.tolerance)
+			if relation != tt.relation || math.Abs(score-tt.score) > 1e-9 || diff != tt.diff {
+				t.Errorf("MatchTempo(%v, %v, %v) = %s, %.2f, %v, want %s, %.2f, %v",
+					tt.want, tt.candidate, tt.tolerance, relation, score, diff, tt.relation, tt.score, tt.diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+// Package music holds musical keys and the rules for mixing tracks together.
+package music
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidKey is returned for text that does not name a key
+var ErrInvalidKey = errors.New("music: not a key")
+
+// Mode is major or minor
+type Mode int
+
+const (
+	Major Mode = iota
+	Minor
+)
+
+// Key is a tonic pitch class, 0 for C up to 11 for B, and a mode
+type Key struct {
+	Tonic int
+	Mode  Mode
+}
+
+var pitchNames = [12]string{"C", "C#", "D", "Eb", "E", "F", "F#", "G", "Ab", "A", "Bb", "B"}
+
+var letterPitches = map[byte]int{'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11}
+
+// String names the key like "A minor" or "Eb major"
+func (k Key) String() string {
+	if k.Mode == Minor {
+		return pitchNames[k.Tonic] + " minor"
+	}
+	return pitchNames[k.Tonic] + " major"
+}
+
+// Camelot returns the key's position on the Camelot wheel: a number from 1 to
+// 12 and A for minor or B for major
+func (k Key) Camelot() (int, byte) {
+	// Moving a fifth up moves one step around the wheel, with C major at 8B.
+	// Minor keys sit next to their relative major on the inner ring.
+	if k.Mode == Minor {
+		n, _ := k.Relative().Camelot()
+		return n, 'A'
+	}
+	return (k.Tonic*7+7)%12 + 1, 'B'
+}
+
+// CamelotCode returns the wheel position as text, like "8A"
+func (k Key) CamelotCode() string {
+	n, letter := k.Camelot()
+	return fmt.Sprintf("%d%c", n, letter)
+}
+
+// CamelotOf returns the Camelot code of a key written as text, or "" when the
+// text is not a key
+func CamelotOf(s string) string {
+	k, err := ParseKey(s)
+	if err != nil {
+		return ""
+	}
+	return k.CamelotCode()
+}
+
+// Relative returns the minor key sharing the notes of a major key, and the other way round
+func (k Key) Relative() Key {
+	if k.Mode == Minor {
+		return Key{Tonic: (k.Tonic + 3) % 12, Mode: Major}
+	}
+	return Key{Tonic: (k.Tonic + 9) % 12, Mode: Minor}
+}
+
+// ParseKey reads keys written the ways producers write them: "A minor",
+// "Am", "F# maj", "Bbm", "c#", or Camelot codes like "8A". A bare note is major.
+func ParseKey(s string) (Key, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Key{}, ErrInvalidKey
+	}
+	if k, ok := parseCamelot(s); ok {
+		return k, nil
+	}
+
+	letter := s[0]
+	if letter >= 'a' && letter <= 'g' {
+		letter -= 'a' - 'A'
+	}
+	tonic, ok := letterPitches[letter]
+	if !ok {
+		return Key{}, ErrInvalidKey
+	}
+	rest := s[1:]
+	switch {
+	case strings.HasPrefix(rest, "#"), strings.HasPrefix(rest, "♯"):
+		tonic++
+		rest = strings.TrimPrefix(strings.TrimPrefix(rest, "#"), "♯")
+	case strings.HasPrefix(rest, "b"), strings.HasPrefix(rest, "♭"):
+		tonic--
+		rest = strings.TrimPrefix(strings.TrimPrefix(rest, "b"), "♭")
+	}
+	key := Key{Tonic: (tonic + 12) % 12}
+
+	rest = strings.TrimSpace(rest)
+	switch strings.ToLower(rest) {
+	case "", "maj", "major", "ionian":
+		key.Mode = Major
+	case "m", "min", "minor", "aeolian":
+		// A capital M on its own is the shorthand for major
+		if rest == "M" {
+			key.Mode = Major
+		} else {
+			key.Mode = Minor
+		}
+	default:
+		return Key{}, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// parseCamelot reads a Camelot code like "8A" or "12b"
+func parseCamelot(s string) (Key, bool) {
+	var n int
+	var letter byte
+	if _, err := fmt.Sscanf(strings.ToUpper(s), "%d%c", &n, &letter); err != nil {
+		return Key{}, false
+	}
+	// Sscanf stops after the letter, so the code must be all there is
+	if n < 1 || n > 12 || (letter != 'A' && letter != 'B') || !strings.EqualFold(s, fmt.Sprintf("%d%c", n, letter)) {
+		return Key{}, false
+	}
+	for tonic := 0; tonic < 12; tonic++ {
+		for _, mode := range []Mode{Major, Minor} {
+			k := Key{Tonic: tonic, Mode: mode}
+			if kn, kl := k.Camelot(); kn == n && kl == letter {
+				return k, true
+			}
+		}
+	}
+	return Key{}, false
+}
@@ -0,0 +1,108 @@
+package music
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Key
+	}{
+		{"A minor", Key{9, Minor}},
+		{"Am", Key{9, Minor}},
+		{"am", Key{9, Minor}},
+		{"AM", Key{9, Major}},
+		{"F# maj", Key{6, Major}},
+		{"F♯ major", Key{6, Major}},
+		{"Bbm", Key{10, Minor}},
+		{"B♭ min", Key{10, Minor}},
+		{"Bb", Key{10, Major}},
+		{"bm", Key{11, Minor}},
+		{"c#", Key{1, Major}},
+		{"Cb", Key{11, Major}},
+		{"E aeolian", Key{4, Minor}},
+		{" D ionian ", Key{2, Major}},
+		{"8A", Key{9, Minor}},
+		{"8B", Key{0, Major}},
+		{"12b", Key{4, Major}},
+		{"1A", Key{8, Minor}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseKey(tt.in)
+			if err != nil {
+				t.Fatalf("ParseKey(%q) failed: %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseKey(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseKeyRejects(t *testing.T) {
+	for _, in := range []string{"", "  ", "H", "X minor", "A dorian", "13A", "0B", "8C", "8AB", "Am7"} {
+		t.Run(in, func(t *testing.T) {
+			if k, err := ParseKey(in); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("ParseKey(%q) = %v, %v, want ErrInvalidKey", in, k, err)
+			}
+		})
+	}
+}
+
+func TestCamelot(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"C major", "8B"},
+		{"A minor", "8A"},
+		{"G major", "9B"},
+		{"E minor", "9A"},
+		{"F major", "7B"},
+		{"D minor", "7A"},
+		{"Ab major", "4B"},
+		{"F minor", "4A"},
+		{"B major", "1B"},
+		{"G# minor", "1A"},
+		{"E major", "12B"},
+		{"C# minor", "12A"},
+		{"Gb major", "2B"},
+		{"Eb minor", "2A"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := CamelotOf(tt.key); got != tt.want {
+				t.Errorf("CamelotOf(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+	if got := CamelotOf("not a key"); got != "" {
+		t.Errorf(`CamelotOf("not a key") = %q, want ""`, got)
+	}
+}
+
+func TestCamelotRoundTrip(t *testing.T) {
+	seen := map[string]bool{}
+	for tonic := 0; tonic < 12; tonic++ {
+		for _, mode := range []Mode{Major, Minor} {
+			k := Key{Tonic: tonic, Mode: mode}
+			code := k.CamelotCode()
+			if seen[code] {
+				t.Errorf("%v shares Camelot code %s with another key", k, code)
+			}
+			seen[code] = true
+
+			for _, text := range []string{code, k.String()} {
+				if got, err := ParseKey(text); err != nil || got != k {
+					t.Errorf("ParseKey(%q) = %v, %v, want %v", text, got, err, k)
+				}
+			}
+			if r := k.Relative(); r.Mode == k.Mode || r.Relative() != k {
+				t.Errorf("Relative of %v is %v", k, r)
+			}
+		}
+	}
+}
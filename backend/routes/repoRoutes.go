@@ -2,6 +2,7 @@ package routes
 
 import (
 	controllers "prodhub-backend/controller"
+	"prodhub-backend/helpers"
 	"prodhub-backend/middleware"
 
 	"github.com/gin-gonic/gin"
@@ -11,22 +12,83 @@ func RepoRoutes(router *gin.Engine) {
 	repo := router.Group("/repo")
 	repo.Use(middleware.Authentication())
 
+	// Access checks for routes scoped to a single repository
+	canRead := middleware.RequireRepoAccess(helpers.AccessRead)
+	canContribute := middleware.RequireRepoAccess(helpers.AccessContribute)
+	canMaintain := middleware.RequireRepoAccess(helpers.AccessMaintain)
+	isOwner := middleware.RequireRepoAccess(helpers.AccessOwner)
+
 	{
 		// Repository Routes
 		repo.GET("/", controllers.GetAllPublicRepos)
-		repo.POST("/create", controllers.CreateRepo)	
-		repo.GET("/:id", controllers.GetRepo)
-		repo.PUT("/:id", controllers.UpdateRepo)
-		repo.DELETE("/:id", controllers.DeleteRepo)
-		repo.POST("/upload",controllers.UploadFile)
+		repo.GET("/search", controllers.SearchCompatibleRepos)
+		repo.POST("/create", controllers.CreateRepo)
+		repo.GET("/:id", canRead, controllers.GetRepo)
+		repo.PUT("/:id", canMaintain, controllers.UpdateRepo)
+		repo.DELETE("/:id", isOwner, controllers.DeleteRepo)
+		repo.POST("/upload", controllers.UploadFile)
+		repo.POST("/:id/fork", canRead, controllers.ForkRepo)
+
+		// Collaborator Routes
+		repo.GET("/invitations", controllers.GetMyInvitations)
+		repo.POST("/:id/invitations", canMaintain, controllers.InviteCollaborator)
+		repo.GET("/:id/invitations", canMaintain, controllers.GetRepoInvitations)
+		repo.POST("/:id/invitations/:invitationId/accept", controllers.AcceptInvitation)
+		repo.POST("/:id/invitations/:invitationId/decline", controllers.DeclineInvitation)
+		repo.PUT("/:id/collaborators/:userId", canMaintain, controllers.UpdateCollaboratorRole)
+		repo.DELETE("/:id/collaborators/:userId", canMaintain, controllers.RemoveCollaborator)
+
+		// Ownership Transfer Routes
+		repo.POST("/:id/transfer", isOwner, controllers.RequestTransfer)
+		repo.DELETE("/:id/transfer", isOwner, controllers.CancelTransfer)
+		repo.POST("/:id/transfer/accept", controllers.AcceptTransfer)
+		repo.POST("/:id/transfer/decline", controllers.DeclineTransfer)
 
 		// Branch Routes
-		repo.POST("/:id/branch", controllers.CreateBranch)
-		repo.GET("/:id/branch/:branchName", controllers.GetBranch)
-		repo.DELETE("/:id/branch/:branchName", controllers.DeleteBranch)
+		repo.POST("/:id/branch", canContribute, controllers.CreateBranch)
+		repo.GET("/:id/branch/:branchName", canRead, controllers.GetBranch)
+		repo.DELETE("/:id/branch/:branchName", canMaintain, controllers.DeleteBranch)
+		repo.POST("/:id/merge", canMaintain, controllers.MergeBranches)
 
 		// Version Routes
-		repo.POST("/:id/branch/:branchName/version", controllers.AddVersion)
+		repo.POST("/:id/branch/:branchName/version", canContribute, controllers.AddVersion)
+		repo.POST("/:id/branch/:branchName/uploads", canContribute, controllers.StartUpload)
+		repo.GET("/:id/uploads/:uploadId", canContribute, controllers.GetUpload)
+		repo.PUT("/:id/uploads/:uploadId/files/:fileId", canContribute, controllers.UploadChunk)
+		repo.POST("/:id/uploads/:uploadId/complete", canContribute, controllers.CompleteUpload)
+		repo.DELETE("/:id/uploads/:uploadId", canContribute, controllers.AbortUpload)
+		repo.GET("/:id/branch/:branchName/versions", canRead, controllers.GetBranchVersions)
+		repo.GET("/:id/compare", canRead, controllers.CompareVersions)
+		repo.GET("/:id/versions/:versionId/assets/:assetId/peaks", canRead, controllers.GetAssetPeaks)
+		repo.GET("/:id/versions/:versionId/download", canRead, controllers.DownloadVersion)
+
+		// Tag and Release Routes
+		repo.POST("/:id/tags", canMaintain, controllers.CreateTag)
+		repo.GET("/:id/tags", canRead, controllers.GetTags)
+		repo.DELETE("/:id/tags/:tagName", isOwner, controllers.DeleteTag)
+		repo.POST("/:id/releases", canMaintain, controllers.CreateRelease)
+		repo.GET("/:id/releases", canRead, controllers.GetReleases)
+		repo.GET("/:id/releases/:releaseId/assets/:assetName/download", canRead, controllers.DownloadReleaseAsset)
+		repo.DELETE("/:id/releases/:releaseId", isOwner, controllers.DeleteRelease)
+
+		// Review Request Routes
+		repo.POST("/:id/reviews", canRead, controllers.CreateReview)
+		repo.GET("/:id/reviews", canRead, controllers.GetReviews)
+		repo.GET("/:id/reviews/:reviewId", canRead, controllers.GetReview)
+		repo.POST("/:id/reviews/:reviewId/comments", canRead, controllers.CommentOnReview)
+		repo.POST("/:id/reviews/:reviewId/approve", canContribute, controllers.ApproveReview)
+		repo.POST("/:id/reviews/:reviewId/close", canRead, controllers.CloseReview)
+		repo.POST("/:id/reviews/:reviewId/merge", canMaintain, controllers.MergeReview)
+
+		// Comment Routes
+		repo.POST("/:id/versions/:versionId/comments", canRead, controllers.AddComment)
+		repo.GET("/:id/versions/:versionId/comments", canRead, controllers.GetVersionComments)
+		repo.GET("/:id/comments", canRead, controllers.GetRepoComments)
+		repo.PUT("/:id/comments/:commentId/resolve", canRead, controllers.ResolveComment)
 
+		// History Routes
+		repo.GET("/:id/versions/:versionId/ancestry", canRead, controllers.GetVersionAncestry)
+		repo.GET("/:id/common-ancestor", canRead, controllers.GetCommonAncestor)
+		repo.GET("/:id/graph", canRead, controllers.GetVersionGraph)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"net/http"
+	"prodhub-backend/config"
+	"prodhub-backend/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StorageRoutes serves uploaded files when they are kept on local disk.
+// Cloud backends serve their objects themselves, so nothing is mounted for them.
+func StorageRoutes(router *gin.Engine) {
+	local, ok := config.Storage.(*storage.Local)
+	if !ok {
+		return
+	}
+	router.GET("/files/*key", gin.WrapH(http.StripPrefix("/files", local)))
+}
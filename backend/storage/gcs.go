@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// GCS stores objects in a Firebase/Google Cloud Storage bucket
+type GCS struct {
+	bucket *gcs.BucketHandle
+}
+
+// NewGCS wraps an initialized bucket handle. Objects are written without a
+// public ACL; clients reach them through SignedURL.
+func NewGCS(bucket *gcs.BucketHandle) *GCS {
+	return &GCS{bucket: bucket}
+}
+
+func (s *GCS) Put(ctx context.Context, key string, r io.Reader, contentType string) (int64, error) {
+	writer := s.bucket.Object(key).NewWriter(ctx)
+	writer.ContentType = contentType
+
+	bytesCopied, err := io.Copy(writer, r)
+	if err != nil {
+		writer.Close()
+		return bytesCopied, fmt.Errorf("failed to copy file data (bytes copied: %d): %v", bytesCopied, err)
+	}
+	if err := writer.Close(); err != nil {
+		return bytesCopied, fmt.Errorf("failed to close writer: %v", err)
+	}
+	return bytesCopied, nil
+}
+
+func (s *GCS) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	reader, err := s.bucket.Object(key).NewReader(ctx)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return nil, ErrNotExist
+	}
+	return reader, err
+}
+
+func (s *GCS) Delete(ctx context.Context, key string) error {
+	err := s.bucket.Object(key).Delete(ctx)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return ErrNotExist
+	}
+	return err
+}
+
+func (s *GCS) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	attrs, err := s.bucket.Object(key).Attrs(ctx)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return objectInfoFromAttrs(attrs), nil
+}
+
+func (s *GCS) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	objects := []ObjectInfo{}
+	it := s.bucket.Objects(ctx, &gcs.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, *objectInfoFromAttrs(attrs))
+	}
+	return objects, nil
+}
+
+func (s *GCS) SignedURL(ctx context.Context, key, fileName string, expiry time.Duration) (string, error) {
+	opts := &gcs.SignedURLOptions{
+		Scheme:  gcs.SigningSchemeV4,
+		Method:  "GET",
+		Expires: time.Now().Add(expiry),
+	}
+	if fileName != "" {
+		opts.QueryParameters = url.Values{
+			"response-content-disposition": {mime.FormatMediaType("attachment", map[string]string{"filename": fileName})},
+		}
+	}
+	return s.bucket.SignedURL(key, opts)
+}
+
+// publicMembers are the IAM members and ACL entities that grant anyone access
+var publicMembers = []gcs.ACLEntity{gcs.AllUsers, gcs.AllAuthenticatedUsers}
+
+// RevokePublicAccess closes the bucket to anonymous readers. Uploads made
+// before objects became private were read through public
+// https://storage.googleapis.com/<bucket>/<key> URLs, granted either by a
+// bucket IAM binding or by object ACLs, and stay readable there until this
+// runs. It enforces public access prevention, drops public IAM bindings and
+// removes public entries from the default and object ACLs. It returns the
+// number of objects whose ACL changed.
+func (s *GCS) RevokePublicAccess(ctx context.Context) (int, error) {
+	update := gcs.BucketAttrsToUpdate{PublicAccessPrevention: gcs.PublicAccessPreventionEnforced}
+	attrs, err := s.bucket.Update(ctx, update)
+	if err != nil {
+		return 0, fmt.Errorf("failed to enforce public access prevention: %v", err)
+	}
+
+	handle := s.bucket.IAM()
+	policy, err := handle.Policy(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read bucket IAM policy: %v", err)
+	}
+	changed := false
+	for _, role := range policy.Roles() {
+		for _, member := range publicMembers {
+			if policy.HasRole(string(member), role) {
+				policy.Remove(string(member), role)
+				changed = true
+			}
+		}
+	}
+	if changed {
+		if err := handle.SetPolicy(ctx, policy); err != nil {
+			return 0, fmt.Errorf("failed to update bucket IAM policy: %v", err)
+		}
+	}
+
+	// With uniform bucket-level access, ACLs are not consulted at all
+	if attrs.UniformBucketLevelAccess.Enabled {
+		return 0, nil
+	}
+	for _, rule := range attrs.DefaultObjectACL {
+		if isPublic(rule.Entity) {
+			if err := s.bucket.DefaultObjectACL().Delete(ctx, rule.Entity); err != nil {
+				return 0, fmt.Errorf("failed to update default object ACL: %v", err)
+			}
+		}
+	}
+
+	revoked := 0
+	it := s.bucket.Objects(ctx, &gcs.Query{Projection: gcs.ProjectionFull})
+	for {
+		object, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return revoked, err
+		}
+		public := false
+		for _, rule := range object.ACL {
+			if isPublic(rule.Entity) {
+				if err := s.bucket.Object(object.Name).ACL().Delete(ctx, rule.Entity); err != nil {
+					return revoked, fmt.Errorf("failed to update ACL of %s: %v", object.Name, err)
+				}
+				public = true
+			}
+		}
+		if public {
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+func isPublic(entity gcs.ACLEntity) bool {
+	for _, member := range publicMembers {
+		if entity == member {
+			return true
+		}
+	}
+	return false
+}
+
+func objectInfoFromAttrs(attrs *gcs.ObjectAttrs) *ObjectInfo {
+	return &ObjectInfo{
+		Key:         attrs.Name,
+		Size:        attrs.Size,
+		ContentType: attrs.ContentType,
+		Updated:     attrs.Updated,
+	}
+}
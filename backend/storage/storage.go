@@ -0,0 +1,37 @@
+// Package storage abstracts the object store that holds uploaded project files.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotExist is returned when the requested object is not in the store
+var ErrNotExist = errors.New("object does not exist")
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"contentType"`
+	Updated     time.Time `json:"updated"`
+}
+
+// Storage is implemented by every object store backend (Firebase/GCS, local disk)
+type Storage interface {
+	// Put writes the contents of r under key and returns the number of bytes written
+	Put(ctx context.Context, key string, r io.Reader, contentType string) (int64, error)
+	// Get opens the object stored under key. The caller must close the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object stored under key
+	Delete(ctx context.Context, key string) error
+	// Stat returns the metadata of the object stored under key
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// List returns every object whose key starts with prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// SignedURL returns a URL granting read access to key until expiry elapses.
+	// When fileName is set the object is served as an attachment of that name.
+	SignedURL(ctx context.Context, key, fileName string, expiry time.Duration) (string, error)
+}
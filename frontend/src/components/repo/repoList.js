@@ -14,7 +14,7 @@ const RepoList = () => {
       try {
         setLoading(true);
         const repos = await getAllRepos();
-        setRepos(repos.data);
+        setRepos(repos.data.repos);
       } catch (err) {
         console.error(err);
       } finally {